@@ -11,10 +11,12 @@ import (
 	"github.com/ursiform/forest"
 )
 
-func Authenticate(app *forest.App) func(ctx *bear.Context) {
+func Authenticate(app *forest.App, opts ...Option) func(ctx *bear.Context) {
+	o := newOptions(opts)
 	return func(ctx *bear.Context) {
 		userID, ok := ctx.Get(forest.SessionUserID).(string)
 		if !ok || len(userID) == 0 {
+			logResponse(o, ctx, http.StatusUnauthorized)
 			app.Response(ctx, http.StatusUnauthorized, forest.Failure,
 				app.Error("Unauthorized")).Write(nil)
 			return
@@ -12,13 +12,15 @@ import (
 	"github.com/ursiform/forest"
 )
 
-func BodyParser(app *forest.App) func(ctx *bear.Context) {
+func BodyParser(app *forest.App, opts ...Option) func(ctx *bear.Context) {
+	o := newOptions(opts)
 	return func(ctx *bear.Context) {
 		destination, ok := ctx.Get(forest.Body).(Populater)
 		if !ok {
 			ctx.Set(forest.Error,
 				fmt.Errorf("(*forest.App).BodyParser unitialized"))
 			message := safeErrorMessage(app, ctx, app.Error("Parse"))
+			logResponse(o, ctx, http.StatusInternalServerError)
 			app.Response(ctx, http.StatusInternalServerError,
 				forest.Failure, message).Write(nil)
 			return
@@ -27,6 +29,7 @@ func BodyParser(app *forest.App) func(ctx *bear.Context) {
 			ctx.Set(forest.SafeError,
 				fmt.Errorf("%s: body is empty", app.Error("Parse")))
 			message := safeErrorMessage(app, ctx, app.Error("Parse"))
+			logResponse(o, ctx, http.StatusBadRequest)
 			app.Response(ctx, http.StatusBadRequest,
 				forest.Failure, message).Write(nil)
 			return
@@ -35,6 +38,7 @@ func BodyParser(app *forest.App) func(ctx *bear.Context) {
 			ctx.Set(forest.SafeError,
 				fmt.Errorf("%s: %s", app.Error("Parse"), err))
 			message := safeErrorMessage(app, ctx, app.Error("Parse"))
+			logResponse(o, ctx, http.StatusBadRequest)
 			app.Response(ctx, http.StatusBadRequest,
 				forest.Failure, message).Write(nil)
 			return
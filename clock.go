@@ -0,0 +1,69 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time to the session managers and wares, which use it for
+// every expiry decision. The default is the system clock.
+type Clock interface {
+	Now() time.Time
+}
+
+// FakeClock is a Clock that only moves when it is told to, for tests that
+// need to control expiry. It is safe for concurrent use.
+type FakeClock struct {
+	mutex sync.RWMutex
+	now   time.Time
+}
+
+type systemClock struct{}
+
+// NewFakeClock returns a FakeClock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Advance moves clock forward by d.
+func (clock *FakeClock) Advance(d time.Duration) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	clock.now = clock.now.Add(d)
+}
+
+func (clock *FakeClock) Now() time.Time {
+	clock.mutex.RLock()
+	defer clock.mutex.RUnlock()
+	return clock.now
+}
+
+// Set moves clock to now.
+func (clock *FakeClock) Set(now time.Time) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	clock.now = now
+}
+
+func (clock systemClock) Now() time.Time { return time.Now() }
+
+// WithClock sets the Clock the wares use to decide when sessions are due for
+// a refresh or past their absolute timeout, and to date the session cookies
+// described by WithCookie; the default cookies are dated by app.SetCookie,
+// which uses the system clock. It does not affect session managers, which
+// take a Clock in their configs.
+func WithClock(clock Clock) Option {
+	return func(o *options) { o.clock = clock }
+}
+
+// clockOrSystem returns clock, or the system clock if clock is nil.
+func clockOrSystem(clock Clock) Clock {
+	if clock == nil {
+		return systemClock{}
+	}
+	return clock
+}
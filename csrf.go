@@ -14,12 +14,14 @@ import (
 	"github.com/ursiform/forest"
 )
 
-func CSRF(app *forest.App) func(ctx *bear.Context) {
+func CSRF(app *forest.App, opts ...Option) func(ctx *bear.Context) {
+	o := newOptions(opts)
 	type postBody struct {
 		SessionID string `json:"sessionid"` // forest.SessionID == "sessionid"
 	}
 	return func(ctx *bear.Context) {
 		if ctx.Request.Body == nil {
+			logResponse(o, ctx, http.StatusBadRequest)
 			app.Response(ctx, http.StatusBadRequest,
 				forest.Failure, app.Error("CSRF")).Write(nil)
 			return
@@ -27,6 +29,7 @@ func CSRF(app *forest.App) func(ctx *bear.Context) {
 		pb := new(postBody)
 		body, _ := ioutil.ReadAll(ctx.Request.Body)
 		if body == nil || len(body) < 2 { // smallest JSON body is {}, 2 chars
+			logResponse(o, ctx, http.StatusBadRequest)
 			app.Response(
 				ctx,
 				http.StatusBadRequest,
@@ -37,6 +40,7 @@ func CSRF(app *forest.App) func(ctx *bear.Context) {
 		// set ctx.Request.Body back to an untouched io.ReadCloser
 		ctx.Request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
 		if err := json.Unmarshal(body, pb); err != nil {
+			logResponse(o, ctx, http.StatusBadRequest)
 			app.Response(
 				ctx,
 				http.StatusBadRequest,
@@ -46,6 +50,7 @@ func CSRF(app *forest.App) func(ctx *bear.Context) {
 		}
 		sessionID, ok := ctx.Get(forest.SessionID).(string)
 		if !ok || sessionID != pb.SessionID {
+			logResponse(o, ctx, http.StatusBadRequest)
 			app.Response(
 				ctx,
 				http.StatusBadRequest,
@@ -11,8 +11,11 @@ import (
 	"github.com/ursiform/forest"
 )
 
-func ErrorsBadRequest(app *forest.App) func(ctx *bear.Context) {
+func ErrorsBadRequest(app *forest.App,
+	opts ...Option) func(ctx *bear.Context) {
+	o := newOptions(opts)
 	return func(ctx *bear.Context) {
+		logResponse(o, ctx, http.StatusBadRequest)
 		app.Response(
 			ctx,
 			http.StatusBadRequest,
@@ -21,8 +24,11 @@ func ErrorsBadRequest(app *forest.App) func(ctx *bear.Context) {
 	}
 }
 
-func ErrorsConflict(app *forest.App) func(ctx *bear.Context) {
+func ErrorsConflict(app *forest.App,
+	opts ...Option) func(ctx *bear.Context) {
+	o := newOptions(opts)
 	return func(ctx *bear.Context) {
+		logResponse(o, ctx, http.StatusConflict)
 		app.Response(
 			ctx,
 			http.StatusConflict,
@@ -31,8 +37,11 @@ func ErrorsConflict(app *forest.App) func(ctx *bear.Context) {
 	}
 }
 
-func ErrorsMethodNotAllowed(app *forest.App) func(ctx *bear.Context) {
+func ErrorsMethodNotAllowed(app *forest.App,
+	opts ...Option) func(ctx *bear.Context) {
+	o := newOptions(opts)
 	return func(ctx *bear.Context) {
+		logResponse(o, ctx, http.StatusMethodNotAllowed)
 		app.Response(
 			ctx,
 			http.StatusMethodNotAllowed,
@@ -41,15 +50,21 @@ func ErrorsMethodNotAllowed(app *forest.App) func(ctx *bear.Context) {
 	}
 }
 
-func ErrorsNotFound(app *forest.App) func(ctx *bear.Context) {
+func ErrorsNotFound(app *forest.App,
+	opts ...Option) func(ctx *bear.Context) {
+	o := newOptions(opts)
 	return func(ctx *bear.Context) {
+		logResponse(o, ctx, http.StatusNotFound)
 		message := safeErrorMessage(app, ctx, app.Error("NotFound"))
 		app.Response(ctx, http.StatusNotFound, forest.Failure, message).Write(nil)
 	}
 }
 
-func ErrorsServerError(app *forest.App) func(ctx *bear.Context) {
+func ErrorsServerError(app *forest.App,
+	opts ...Option) func(ctx *bear.Context) {
+	o := newOptions(opts)
 	return func(ctx *bear.Context) {
+		logResponse(o, ctx, http.StatusInternalServerError)
 		app.Response(
 			ctx,
 			http.StatusInternalServerError,
@@ -58,8 +73,11 @@ func ErrorsServerError(app *forest.App) func(ctx *bear.Context) {
 	}
 }
 
-func ErrorsUnauthorized(app *forest.App) func(ctx *bear.Context) {
+func ErrorsUnauthorized(app *forest.App,
+	opts ...Option) func(ctx *bear.Context) {
+	o := newOptions(opts)
 	return func(ctx *bear.Context) {
+		logResponse(o, ctx, http.StatusUnauthorized)
 		app.Response(
 			ctx,
 			http.StatusUnauthorized,
@@ -0,0 +1,18 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// sha256Hex returns the SHA-256 hash of data in hex. It stands in for session
+// IDs, which are credentials, wherever they would otherwise be revealed, e.g.
+// in logs, file names, and session lists, and for client fingerprints.
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,77 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares
+
+import (
+	"log/slog"
+
+	"github.com/ursiform/bear"
+	"github.com/ursiform/forest"
+)
+
+// Logger receives the events logged by the wares in this package as a message
+// followed by alternating keys and values. A *slog.Logger satisfies it.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+}
+
+var _ Logger = (*slog.Logger)(nil)
+
+// defaultLogger is the default Logger. It logs to slog.Default() as of each
+// call, so it follows slog.SetDefault.
+type defaultLogger struct{}
+
+func (logger defaultLogger) Debug(msg string, args ...interface{}) {
+	slog.Default().Debug(msg, args...)
+}
+
+func (logger defaultLogger) Error(msg string, args ...interface{}) {
+	slog.Default().Error(msg, args...)
+}
+
+func (logger defaultLogger) Info(msg string, args ...interface{}) {
+	slog.Default().Info(msg, args...)
+}
+
+func (logger defaultLogger) Warn(msg string, args ...interface{}) {
+	slog.Default().Warn(msg, args...)
+}
+
+// WithLogger sets the Logger that wares report failures to. It defaults to
+// slog.Default().
+func WithLogger(logger Logger) Option {
+	return func(o *options) { o.logger = logger }
+}
+
+// logArgs returns the structured fields that describe a request, along with
+// err and, if it is not empty, a hash of sessionID, which is never logged as
+// is because it is a credential.
+func logArgs(ctx *bear.Context, sessionID string, err error) []interface{} {
+	args := []interface{}{
+		"method", ctx.Request.Method,
+		"route", ctx.Request.URL.Path}
+	if sessionID != "" {
+		args = append(args, "session", sha256Hex([]byte(sessionID)))
+	}
+	if err != nil {
+		args = append(args, "error", err.Error())
+	}
+	return args
+}
+
+// logResponse logs an error response written by a ware, at the Error level
+// for server errors and at the Warn level otherwise.
+func logResponse(o *options, ctx *bear.Context, code int) {
+	err, _ := ctx.Get(forest.Error).(error)
+	args := append(logArgs(ctx, "", err), "status", code)
+	if code >= 500 {
+		o.logger.Error("error response", args...)
+		return
+	}
+	o.logger.Warn("error response", args...)
+}
@@ -0,0 +1,286 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ursiform/bear"
+	"github.com/ursiform/forest"
+)
+
+// hostPrefix is the cookie name prefix that browsers only accept on secure,
+// host-only cookies with a path of "/".
+const hostPrefix = "__Host-"
+
+// touchInterval is how often SessionGet records the client using a session
+// that is read but not refreshed, unless the client changes in the meantime.
+const touchInterval = time.Minute
+
+// Option configures the wares created by the generators and installers in
+// this package. Options that do not apply to a ware are ignored by it.
+type Option func(*options)
+
+// LimitPolicy decides what happens when a login would exceed the limit set by
+// WithSessionLimit.
+type LimitPolicy int
+
+const (
+	// LimitReject refuses the new session.
+	LimitReject LimitPolicy = iota
+	// LimitEvictOldest deletes the user's oldest sessions to make room.
+	LimitEvictOldest
+)
+
+type binding struct {
+	fingerprint Fingerprint
+	mode        BindingMode
+	onMismatch  func(ctx *bear.Context, info *SessionInfo, fingerprint string)
+}
+
+// CookieOptions describes the session cookie. Unlike the defaults, which defer
+// to app.SetCookie, every attribute is set as given, so Secure must be set
+// explicitly. Like the defaults, the cookie is HttpOnly.
+type CookieOptions struct {
+	// AllowScriptAccess drops the HttpOnly attribute, letting scripts read
+	// the session cookie. Leave it unset unless a client cannot do without.
+	AllowScriptAccess bool
+	// Domain is the cookie's Domain attribute; it is ignored if HostPrefix is
+	// set.
+	Domain string
+	// HostPrefix prepends "__Host-" to the cookie name, which requires the
+	// cookie to be Secure, host-only, and scoped to "/", so those attributes
+	// are forced when it is set.
+	HostPrefix bool
+	// Name is the cookie name; it defaults to forest.SessionID.
+	Name string
+	// Path is the cookie's Path attribute; it defaults to app.Config.CookiePath
+	// or "/".
+	Path     string
+	SameSite http.SameSite
+	Secure   bool
+}
+
+type options struct {
+	absoluteTimeout  time.Duration
+	binding          *binding
+	clientIP         func(request *http.Request) string
+	clock            Clock
+	cookie           *CookieOptions
+	extractors       []TokenExtractor
+	idleTimeout      time.Duration
+	lazy             bool
+	limit            int
+	limitPolicy      LimitPolicy
+	logger           Logger
+	migrations       Migrations
+	observers        []SessionObserver
+	refreshThreshold float64
+	tenant           TenantResolver
+	version          int
+}
+
+// WithAbsoluteTimeout caps the lifetime of a session, measured from when it
+// was first stored, no matter how active it is or whether it has since been
+// regenerated. Once the cap is reached SessionGet discards the session,
+// forcing the user to authenticate again.
+// It is only enforced for a SessionManager that implements SessionInfoReader,
+// and for a CookieSessionManager, whose cookies record when they were issued.
+func WithAbsoluteTimeout(timeout time.Duration) Option {
+	return func(o *options) { o.absoluteTimeout = timeout }
+}
+
+// WithBinding binds each session to the fingerprint of the client that
+// logged in, as recorded by SessionSet, and makes SessionGet compare it with
+// the fingerprint of every later request, including that of a session that
+// was never bound. On a mismatch, onMismatch (if it is not nil) is called
+// with the session and the request's fingerprint, and mode decides whether
+// the session is honored. It is only enforced for a SessionManager that
+// supports SessionFingerprinter and SessionInfoReader.
+func WithBinding(fingerprint Fingerprint, mode BindingMode,
+	onMismatch func(ctx *bear.Context, info *SessionInfo,
+		fingerprint string)) Option {
+	return func(o *options) {
+		o.binding = &binding{
+			fingerprint: fingerprint,
+			mode:        mode,
+			onMismatch:  onMismatch}
+	}
+}
+
+// WithClientIP sets how the IP address recorded by SessionToucher is read from
+// a request. By default it is the host of request.RemoteAddr, which is the
+// proxy's address for an app behind a reverse proxy; see RemoteAddrIP.
+func WithClientIP(clientIP func(request *http.Request) string) Option {
+	return func(o *options) { o.clientIP = clientIP }
+}
+
+// WithCookie sets the attributes of the session cookie.
+func WithCookie(cookie CookieOptions) Option {
+	return func(o *options) { o.cookie = &cookie }
+}
+
+// WithExtractors sets where the session wares look for a session token. The
+// extractors are tried in order and the first non-empty token is used. By
+// default, only the session cookie is read, so a list that should still
+// accept cookies must include SessionCookieExtractor.
+func WithExtractors(extractors ...TokenExtractor) Option {
+	return func(o *options) { o.extractors = extractors }
+}
+
+// WithIdleTimeout sets how long a session may go unused before it expires,
+// overriding app.Duration("Session").
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(o *options) { o.idleTimeout = timeout }
+}
+
+// WithLazySessions defers creating a session for an anonymous visitor until
+// it is written to by SessionSet or SessionRegenerate. Until then SessionGet
+// sets forest.SessionID to a fresh ID without calling CreateEmpty or setting
+// a cookie, so purely anonymous requests never touch the SessionManager.
+// Because that ID is not persisted, wares that depend on an anonymous session
+// ID surviving across requests, such as CSRF, need an authenticated session.
+func WithLazySessions() Option {
+	return func(o *options) { o.lazy = true }
+}
+
+// WithRefreshThreshold throttles how often SessionGet refreshes a session:
+// the cookie is reset and SessionManager.Update is called only once the given
+// fraction of the session duration has elapsed since the last refresh, e.g.
+// 0.5 refreshes a session at most twice per duration. It is only honored for
+// a SessionManager that implements SessionInfoReader, because the remaining
+// lifetime of the session must be known; otherwise sessions are refreshed on
+// every request.
+func WithRefreshThreshold(fraction float64) Option {
+	return func(o *options) { o.refreshThreshold = fraction }
+}
+
+// WithSessionLimit caps how many sessions a user may hold at once. When
+// SessionSet or SessionRegenerate would store a session beyond the cap, policy
+// either rejects it with ErrSessionLimit or evicts the user's oldest
+// sessions. It is only enforced for a SessionManager that implements
+// SessionLister.
+func WithSessionLimit(max int, policy LimitPolicy) Option {
+	return func(o *options) {
+		o.limit = max
+		o.limitPolicy = policy
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := new(options)
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.logger == nil {
+		o.logger = defaultLogger{}
+	}
+	o.clock = clockOrSystem(o.clock)
+	return o
+}
+
+func (o *options) sessionDuration(app *forest.App) time.Duration {
+	if o.idleTimeout > 0 {
+		return o.idleTimeout
+	}
+	return app.Duration("Session")
+}
+
+// shouldRefresh reports whether enough of a session's duration has elapsed
+// for it to be refreshed.
+func (o *options) shouldRefresh(info *SessionInfo,
+	duration time.Duration) bool {
+	if o.refreshThreshold <= 0 || info.Expires.IsZero() {
+		return true
+	}
+	elapsed := duration - info.Expires.Sub(o.clock.Now())
+	return float64(elapsed) >= o.refreshThreshold*float64(duration)
+}
+
+// shouldTouch reports whether a session that was read but not refreshed
+// should be touched: when its client has changed or it was last seen more
+// than touchInterval ago.
+func (o *options) shouldTouch(info *SessionInfo,
+	request *http.Request) bool {
+	return info.IP != o.ip(request) ||
+		info.UserAgent != request.UserAgent() ||
+		o.clock.Now().Sub(info.LastSeen) >= touchInterval
+}
+
+func (o *options) ip(request *http.Request) string {
+	if o.clientIP != nil {
+		return o.clientIP(request)
+	}
+	return RemoteAddrIP(request)
+}
+
+// cookieName returns the name of the session cookie for request, which is
+// suffixed with its tenant if tenants are enabled.
+func (o *options) cookieName(request *http.Request) string {
+	name := forest.SessionID
+	if o.cookie != nil && o.cookie.Name != "" {
+		name = o.cookie.Name
+	}
+	if o.cookie != nil && o.cookie.HostPrefix {
+		name = hostPrefix + name
+	}
+	if o.tenant != nil {
+		name += tenantCookieSuffix(o.tenant(request))
+	}
+	return name
+}
+
+// token returns the first session token found by the configured extractors,
+// and whether the session cookie carries it. A token carried any other way is
+// never written to the session cookie, so API clients do not become cookie
+// clients and a link with a token in it cannot plant a session in a browser.
+func (o *options) token(request *http.Request) (string, bool) {
+	name := o.cookieName(request)
+	cookie := SessionCookieExtractor()(request, name)
+	if len(o.extractors) == 0 {
+		return cookie, cookie != ""
+	}
+	for _, extract := range o.extractors {
+		if token := extract(request, name); token != "" {
+			return token, token == cookie
+		}
+	}
+	return "", false
+}
+
+// setCookie sets the session cookie to value, or expires it if duration is
+// not positive.
+func (o *options) setCookie(app *forest.App, ctx *bear.Context,
+	value string, duration time.Duration) {
+	if o.cookie == nil {
+		app.SetCookie(ctx, cookiePath(app), o.cookieName(ctx.Request),
+			value, duration)
+		return
+	}
+	cookie := &http.Cookie{
+		Domain:   o.cookie.Domain,
+		Expires:  o.clock.Now().Add(duration),
+		HttpOnly: !o.cookie.AllowScriptAccess,
+		MaxAge:   int(duration / time.Second),
+		Name:     o.cookieName(ctx.Request),
+		Path:     o.cookie.Path,
+		SameSite: o.cookie.SameSite,
+		Secure:   o.cookie.Secure,
+		Value:    value}
+	if cookie.Path == "" {
+		cookie.Path = cookiePath(app)
+	}
+	if duration <= 0 {
+		cookie.Expires = time.Unix(0, 0)
+		cookie.MaxAge = -1
+	}
+	if o.cookie.HostPrefix {
+		cookie.Domain = ""
+		cookie.Path = "/"
+		cookie.Secure = true
+	}
+	http.SetCookie(ctx.ResponseWriter, cookie)
+}
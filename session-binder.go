@@ -0,0 +1,55 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ursiform/bear"
+	"github.com/ursiform/forest"
+)
+
+// SessionBinder implements the Create, CreateEmpty, and Marshal methods of
+// SessionManager by moving a JSON encoded user between a session and the
+// forest.SessionUser key of a bear.Context. It is embedded by the session
+// managers in this package.
+type SessionBinder struct {
+	// NewUser returns a pointer that userJSON is decoded into by Create. If it
+	// is nil, forest.SessionUser is set to the raw json.RawMessage.
+	NewUser func() interface{}
+}
+
+func (binder SessionBinder) Create(sessionID string, userID string,
+	userJSON string, ctx *bear.Context) error {
+	var user interface{}
+	if binder.NewUser == nil {
+		if !json.Valid([]byte(userJSON)) {
+			return fmt.Errorf("Create %s: invalid JSON", sessionID)
+		}
+		user = json.RawMessage(userJSON)
+	} else {
+		user = binder.NewUser()
+		if err := json.Unmarshal([]byte(userJSON), user); err != nil {
+			return fmt.Errorf("Create %s: %s", sessionID, err)
+		}
+	}
+	ctx.Set(forest.SessionID, sessionID)
+	ctx.Set(forest.SessionUserID, userID)
+	ctx.Set(forest.SessionUser, user)
+	return nil
+}
+
+func (binder SessionBinder) CreateEmpty(sessionID string, ctx *bear.Context) {
+	ctx.Set(forest.SessionID, sessionID)
+}
+
+func (binder SessionBinder) Marshal(ctx *bear.Context) ([]byte, error) {
+	user := ctx.Get(forest.SessionUser)
+	if user == nil {
+		return nil, fmt.Errorf("Marshal %s: %v", forest.SessionUser, user)
+	}
+	return json.Marshal(user)
+}
@@ -0,0 +1,75 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares
+
+import (
+	"net"
+	"net/http"
+)
+
+// BindingMode decides what SessionGet does when a request's fingerprint does
+// not match the one its session was bound to.
+type BindingMode int
+
+const (
+	// BindingStrict treats the session as invalid, so the request proceeds
+	// with an anonymous session. The bound session itself is left intact.
+	BindingStrict BindingMode = iota
+	// BindingLenient only reports the mismatch.
+	BindingLenient
+)
+
+// Fingerprint derives a value identifying the client making a request. An
+// empty fingerprint is recorded as is and only matches another empty one, so
+// a session that was never bound, e.g. one stored before binding was
+// enabled, does not match a client with a fingerprint.
+type Fingerprint func(request *http.Request) string
+
+// IPPrefixFingerprint identifies a client by the network prefix of its IP
+// address, as read by clientIP (or RemoteAddrIP if clientIP is nil), so that
+// a client keeps its session as its address moves around within a network.
+func IPPrefixFingerprint(clientIP func(request *http.Request) string,
+	ipv4Bits int, ipv6Bits int) Fingerprint {
+	if clientIP == nil {
+		clientIP = RemoteAddrIP
+	}
+	return func(request *http.Request) string {
+		ip := net.ParseIP(clientIP(request))
+		if ip == nil {
+			return ""
+		}
+		if ipv4 := ip.To4(); ipv4 != nil {
+			return ipv4.Mask(net.CIDRMask(ipv4Bits, 8*net.IPv4len)).String()
+		}
+		return ip.Mask(net.CIDRMask(ipv6Bits, 8*net.IPv6len)).String()
+	}
+}
+
+// TLSCertFingerprint identifies a client by a hash of the TLS client
+// certificate it presented.
+func TLSCertFingerprint() Fingerprint {
+	return func(request *http.Request) string {
+		if request.TLS == nil || len(request.TLS.PeerCertificates) == 0 {
+			return ""
+		}
+		return sha256Hex(request.TLS.PeerCertificates[0].Raw)
+	}
+}
+
+// UserAgentFingerprint identifies a client by a hash of its User-Agent.
+func UserAgentFingerprint() Fingerprint {
+	return func(request *http.Request) string {
+		return sha256Hex([]byte(request.UserAgent()))
+	}
+}
+
+// RemoteAddrIP returns the host of request.RemoteAddr.
+func RemoteAddrIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,302 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultCacheSize = 1024
+	defaultCacheTTL  = 30 * time.Second
+)
+
+type CacheConfig struct {
+	// Clock defaults to the system clock.
+	Clock Clock
+	// Size is the maximum number of sessions cached, after which the least
+	// recently used one is evicted; it defaults to 1024.
+	Size int
+	// TTL is how long a session read from the wrapped manager is served from
+	// the cache; it defaults to 30 seconds.
+	TTL time.Duration
+}
+
+// CacheStats counts the reads a CachedSessionManager served from its cache
+// (Hits) and those it passed through to the wrapped manager (Misses).
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// CachedSessionManager is a SessionManager that caches the sessions read from
+// the SessionManager it wraps. Update, Delete, and Revoke invalidate what they
+// change, but a session changed by another process is only seen once its TTL
+// has elapsed. Only sessions whose expiry the wrapped manager reports, with
+// SessionInfoReader, are cached, so that none is served after it expires; a
+// manager without it gains nothing from the cache. Because SessionGet updates
+// a session whenever it refreshes it, use WithRefreshThreshold for the cache
+// to be effective. It is safe for concurrent use if the wrapped manager is.
+type CachedSessionManager struct {
+	SessionManager
+	// The counters come first to keep them 64-bit aligned for atomic use.
+	generation uint64
+	hits       uint64
+	misses     uint64
+	clock      Clock
+	entries    map[string]*list.Element
+	mutex      sync.Mutex
+	recency    *list.List
+	size       int
+	store      ContextSessionManager
+	ttl        time.Duration
+	users      map[string]map[string]bool
+}
+
+type cacheEntry struct {
+	expires time.Time
+	info    *SessionInfo
+}
+
+func NewCachedSessionManager(manager SessionManager,
+	config *CacheConfig) *CachedSessionManager {
+	if config == nil {
+		config = new(CacheConfig)
+	}
+	size := config.Size
+	if size <= 0 {
+		size = defaultCacheSize
+	}
+	ttl := config.TTL
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	return &CachedSessionManager{
+		SessionManager: manager,
+		clock:          clockOrSystem(config.Clock),
+		entries:        make(map[string]*list.Element),
+		recency:        list.New(),
+		size:           size,
+		store:          NewContextSessionManager(manager),
+		ttl:            ttl,
+		users:          make(map[string]map[string]bool)}
+}
+
+func (cache *CachedSessionManager) Delete(sessionID string,
+	userID string) error {
+	return cache.DeleteContext(context.Background(), sessionID, userID)
+}
+
+func (cache *CachedSessionManager) DeleteContext(c context.Context,
+	sessionID string, userID string) error {
+	defer cache.invalidate(sessionID)
+	return cache.store.DeleteContext(c, sessionID, userID)
+}
+
+// ListSessions passes through to the wrapped manager. It fails if the wrapped
+// manager does not implement SessionLister, in which case neither do the
+// session wares consider the cache to implement it.
+func (cache *CachedSessionManager) ListSessions(
+	userID string) ([]*SessionInfo, error) {
+	lister, ok := cache.SessionManager.(SessionLister)
+	if !ok {
+		return nil, fmt.Errorf("%T does not implement SessionLister",
+			cache.SessionManager)
+	}
+	return lister.ListSessions(userID)
+}
+
+func (cache *CachedSessionManager) Read(sessionID string) (userID string,
+	userJSON string, err error) {
+	return cache.ReadContext(context.Background(), sessionID)
+}
+
+func (cache *CachedSessionManager) ReadContext(c context.Context,
+	sessionID string) (userID string, userJSON string, err error) {
+	info, err := cache.ReadInfoContext(c, sessionID)
+	if info == nil {
+		return "", "", err
+	}
+	return info.UserID, info.UserJSON, nil
+}
+
+func (cache *CachedSessionManager) ReadInfo(
+	sessionID string) (*SessionInfo, error) {
+	return cache.ReadInfoContext(context.Background(), sessionID)
+}
+
+// ReadInfoContext returns a cached session if it is neither stale nor
+// expired, and otherwise reads it from the wrapped manager and caches it.
+// Sessions that do not exist, or whose expiry is unknown, are not cached.
+func (cache *CachedSessionManager) ReadInfoContext(c context.Context,
+	sessionID string) (*SessionInfo, error) {
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+	if info := cache.lookup(sessionID); info != nil {
+		atomic.AddUint64(&cache.hits, 1)
+		return info, nil
+	}
+	atomic.AddUint64(&cache.misses, 1)
+	generation := atomic.LoadUint64(&cache.generation)
+	info, err := cache.load(c, sessionID)
+	if info == nil {
+		return nil, err
+	}
+	cache.insert(info, generation)
+	copied := *info
+	return &copied, nil
+}
+
+func (cache *CachedSessionManager) Revoke(userID string) error {
+	return cache.RevokeContext(context.Background(), userID)
+}
+
+func (cache *CachedSessionManager) RevokeContext(c context.Context,
+	userID string) error {
+	defer cache.invalidateUser(userID)
+	return cache.store.RevokeContext(c, userID)
+}
+
+// SetFingerprint passes through to the wrapped manager. It fails if the
+// wrapped manager does not implement SessionFingerprinter.
+func (cache *CachedSessionManager) SetFingerprint(sessionID string,
+	fingerprint string) error {
+	fingerprinter, ok := cache.SessionManager.(SessionFingerprinter)
+	if !ok {
+		return fmt.Errorf("%T does not implement SessionFingerprinter",
+			cache.SessionManager)
+	}
+	defer cache.invalidate(sessionID)
+	return fingerprinter.SetFingerprint(sessionID, fingerprint)
+}
+
+// Stats returns the number of cache hits and misses so far.
+func (cache *CachedSessionManager) Stats() CacheStats {
+	return CacheStats{
+		Hits:   atomic.LoadUint64(&cache.hits),
+		Misses: atomic.LoadUint64(&cache.misses)}
+}
+
+// Touch passes through to the wrapped manager. It fails if the wrapped
+// manager does not implement SessionToucher.
+func (cache *CachedSessionManager) Touch(sessionID string, ip string,
+	userAgent string) error {
+	toucher, ok := cache.SessionManager.(SessionToucher)
+	if !ok {
+		return fmt.Errorf("%T does not implement SessionToucher",
+			cache.SessionManager)
+	}
+	defer cache.invalidate(sessionID)
+	return toucher.Touch(sessionID, ip, userAgent)
+}
+
+func (cache *CachedSessionManager) Update(sessionID string, userID string,
+	userJSON string, duration time.Duration) error {
+	return cache.UpdateContext(context.Background(),
+		sessionID, userID, userJSON, duration)
+}
+
+func (cache *CachedSessionManager) UpdateContext(c context.Context,
+	sessionID string, userID string, userJSON string,
+	duration time.Duration) error {
+	defer cache.invalidate(sessionID)
+	return cache.store.UpdateContext(c, sessionID, userID, userJSON, duration)
+}
+
+func (cache *CachedSessionManager) unwrap() SessionManager {
+	return cache.SessionManager
+}
+
+// insert caches a session read at generation, unless the cache has been
+// invalidated since, in which case the session may already be stale, or its
+// expiry is unknown, in which case it may expire while cached.
+func (cache *CachedSessionManager) insert(info *SessionInfo,
+	generation uint64) {
+	if info.Expires.IsZero() {
+		return
+	}
+	expires := cache.clock.Now().Add(cache.ttl)
+	if info.Expires.Before(expires) {
+		expires = info.Expires
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if atomic.LoadUint64(&cache.generation) != generation {
+		return
+	}
+	cache.remove(info.SessionID)
+	entry := &cacheEntry{expires: expires, info: info}
+	cache.entries[info.SessionID] = cache.recency.PushFront(entry)
+	if cache.users[info.UserID] == nil {
+		cache.users[info.UserID] = make(map[string]bool)
+	}
+	cache.users[info.UserID][info.SessionID] = true
+	for cache.recency.Len() > cache.size {
+		oldest := cache.recency.Back().Value.(*cacheEntry)
+		cache.remove(oldest.info.SessionID)
+	}
+}
+
+func (cache *CachedSessionManager) invalidate(sessionID string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	atomic.AddUint64(&cache.generation, 1)
+	cache.remove(sessionID)
+}
+
+func (cache *CachedSessionManager) invalidateUser(userID string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	atomic.AddUint64(&cache.generation, 1)
+	for sessionID := range cache.users[userID] {
+		cache.remove(sessionID)
+	}
+}
+
+// load reads a session from the wrapped manager.
+func (cache *CachedSessionManager) load(c context.Context,
+	sessionID string) (*SessionInfo, error) {
+	return readSession(c, cache.SessionManager, sessionID)
+}
+
+// lookup returns a copy of a cached session, or nil if it is not cached or
+// its entry has expired.
+func (cache *CachedSessionManager) lookup(sessionID string) *SessionInfo {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	element, ok := cache.entries[sessionID]
+	if !ok {
+		return nil
+	}
+	entry := element.Value.(*cacheEntry)
+	if !entry.expires.After(cache.clock.Now()) {
+		cache.remove(sessionID)
+		return nil
+	}
+	cache.recency.MoveToFront(element)
+	copied := *entry.info
+	return &copied
+}
+
+// remove must be called while holding the lock.
+func (cache *CachedSessionManager) remove(sessionID string) {
+	element, ok := cache.entries[sessionID]
+	if !ok {
+		return
+	}
+	userID := element.Value.(*cacheEntry).info.UserID
+	cache.recency.Remove(element)
+	delete(cache.entries, sessionID)
+	delete(cache.users[userID], sessionID)
+	if len(cache.users[userID]) == 0 {
+		delete(cache.users, userID)
+	}
+}
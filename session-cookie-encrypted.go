@@ -0,0 +1,73 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// NewEncryptedCookieSessionManager returns a CookieSessionManager whose
+// cookies are encrypted and authenticated with AES-GCM, so that userJSON
+// cannot be read client-side. Every key in config.Keys must be 16, 24, or 32
+// bytes long (AES-128, AES-192, or AES-256).
+func NewEncryptedCookieSessionManager(
+	config *CookieConfig) (*CookieSessionManager, error) {
+	if config == nil || len(config.Keys.Current) == 0 {
+		return nil,
+			errors.New("NewEncryptedCookieSessionManager: key is required")
+	}
+	codec := new(encryptedCodec)
+	for i, key := range config.Keys.all() {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil,
+				fmt.Errorf("NewEncryptedCookieSessionManager: key %d: %s", i, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil,
+				fmt.Errorf("NewEncryptedCookieSessionManager: key %d: %s", i, err)
+		}
+		codec.aeads = append(codec.aeads, aead)
+	}
+	return newCookieSessionManager(config, codec), nil
+}
+
+// encryptedCodec seals cookie payloads with the first AEAD and opens them
+// with any of them.
+type encryptedCodec struct{ aeads []cipher.AEAD }
+
+func (codec *encryptedCodec) open(value string) []byte {
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil
+	}
+	for _, aead := range codec.aeads {
+		size := aead.NonceSize()
+		if len(sealed) < size {
+			continue
+		}
+		payload, err := aead.Open(nil, sealed[:size], sealed[size:], nil)
+		if err == nil {
+			return payload
+		}
+	}
+	return nil
+}
+
+func (codec *encryptedCodec) seal(payload []byte) (string, error) {
+	aead := codec.aeads[0]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, payload, nil)
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
@@ -0,0 +1,501 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/ursiform/bear"
+	"github.com/ursiform/forest"
+)
+
+const maxCookieSize = 4096
+
+// EpochStore holds a revocation epoch per user. Cookies issued before a
+// user's epoch was last incremented are rejected. Deployments with more than
+// one process need an EpochStore shared between them.
+type EpochStore interface {
+	Epoch(userID string) (int64, error)
+	Increment(userID string) error
+}
+
+// Keyring holds the keys for cookie sessions. Current protects new cookies;
+// cookies protected by any of the Previous keys are still accepted, so keys
+// can be rotated without invalidating live sessions.
+type Keyring struct {
+	Current  []byte
+	Previous [][]byte
+}
+
+type CookieConfig struct {
+	// Clock defaults to the system clock.
+	Clock Clock
+	// Epochs defaults to an in-memory EpochStore, which is neither shared
+	// between processes nor kept across restarts: a revoked cookie is
+	// accepted again once the process restarts, until it expires.
+	Epochs EpochStore
+	Keys   Keyring
+	// NewUser is passed through to the embedded SessionBinder.
+	NewUser func() interface{}
+}
+
+// CookieSessionManager is a SessionManager that keeps the whole session,
+// including userJSON, in a signed or encrypted cookie so that no server-side
+// store is needed. It is used with the CookieSession wares, which write the
+// cookie; Update and Delete are no-ops because there is nothing to store, so
+// the other session wares reject it.
+type CookieSessionManager struct {
+	SessionBinder
+	clock  Clock
+	codec  cookieCodec
+	epochs EpochStore
+}
+
+// cookieCodec protects session payloads written to cookies. open returns nil
+// if a value was not produced by seal with any key in the keyring.
+type cookieCodec interface {
+	open(value string) []byte
+	seal(payload []byte) (string, error)
+}
+
+type cookieSession struct {
+	Created   int64  `json:"c,omitempty"`
+	Epoch     int64  `json:"e"`
+	Expires   int64  `json:"x"`
+	SessionID string `json:"s"`
+	UserID    string `json:"u,omitempty"`
+	UserJSON  string `json:"j,omitempty"`
+}
+
+type memoryEpochs struct {
+	epochs map[string]int64
+	mutex  sync.RWMutex
+}
+
+func NewSignedCookieSessionManager(
+	config *CookieConfig) (*CookieSessionManager, error) {
+	if config == nil || len(config.Keys.Current) == 0 {
+		return nil, errors.New("NewSignedCookieSessionManager: key is required")
+	}
+	return newCookieSessionManager(config, &signedCodec{keys: config.Keys}), nil
+}
+
+func newCookieSessionManager(config *CookieConfig,
+	codec cookieCodec) *CookieSessionManager {
+	epochs := config.Epochs
+	if epochs == nil {
+		epochs = &memoryEpochs{epochs: make(map[string]int64)}
+	}
+	return &CookieSessionManager{
+		SessionBinder: SessionBinder{NewUser: config.NewUser},
+		clock:         clockOrSystem(config.Clock),
+		codec:         codec,
+		epochs:        epochs}
+}
+
+func (manager *CookieSessionManager) Delete(sessionID string,
+	userID string) error {
+	return nil
+}
+
+// Encode returns a cookie value holding the session, which is dated as
+// created now if it is authenticated.
+func (manager *CookieSessionManager) Encode(sessionID string, userID string,
+	userJSON string, duration time.Duration) (string, error) {
+	session := &cookieSession{
+		SessionID: sessionID,
+		UserID:    userID,
+		UserJSON:  userJSON}
+	if userID != "" {
+		session.Created = manager.clock.Now().Unix()
+	}
+	return manager.encode(session, duration)
+}
+
+func (manager *CookieSessionManager) Read(value string) (userID string,
+	userJSON string, err error) {
+	session, err := manager.decode(value)
+	if err != nil || session == nil {
+		return "", "", err
+	}
+	return session.UserID, session.UserJSON, nil
+}
+
+func (manager *CookieSessionManager) Revoke(userID string) error {
+	return manager.epochs.Increment(userID)
+}
+
+func (manager *CookieSessionManager) Update(sessionID string, userID string,
+	userJSON string, duration time.Duration) error {
+	return nil
+}
+
+// encode returns a cookie value holding session, which expires after
+// duration and is issued at the current epoch of its user.
+func (manager *CookieSessionManager) encode(session *cookieSession,
+	duration time.Duration) (string, error) {
+	session.Expires = manager.clock.Now().Add(duration).Unix()
+	if session.UserID != "" {
+		epoch, err := manager.epochs.Epoch(session.UserID)
+		if err != nil {
+			return "", err
+		}
+		session.Epoch = epoch
+	}
+	payload, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	value, err := manager.codec.seal(payload)
+	if err != nil {
+		return "", err
+	}
+	if len(value) > maxCookieSize {
+		return "", fmt.Errorf("Encode %s: cookie exceeds %d bytes",
+			session.SessionID, maxCookieSize)
+	}
+	return value, nil
+}
+
+// decode returns nil for cookies that are forged, expired, or revoked.
+func (manager *CookieSessionManager) decode(
+	value string) (*cookieSession, error) {
+	payload := manager.codec.open(value)
+	if payload == nil {
+		return nil, nil
+	}
+	session := new(cookieSession)
+	if err := json.Unmarshal(payload, session); err != nil {
+		return nil, nil
+	}
+	if session.Expires <= manager.clock.Now().Unix() {
+		return nil, nil
+	}
+	if session.UserID != "" {
+		epoch, err := manager.epochs.Epoch(session.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if session.Epoch < epoch {
+			return nil, nil
+		}
+	}
+	return session, nil
+}
+
+// decodeTenant decodes value, which must have been encoded for the tenant
+// whose keys are namespaced by prefix, and strips the prefix from its IDs.
+func (manager *CookieSessionManager) decodeTenant(value string,
+	prefix tenantPrefix) (*cookieSession, error) {
+	session, err := manager.decode(value)
+	if session == nil {
+		return nil, err
+	}
+	sessionID, ok := prefix.id(session.SessionID)
+	if !ok {
+		return nil, nil
+	}
+	userID, ok := prefix.id(session.UserID)
+	if !ok {
+		return nil, nil
+	}
+	session.SessionID, session.UserID = sessionID, userID
+	return session, nil
+}
+
+func (keys Keyring) all() [][]byte {
+	return append([][]byte{keys.Current}, keys.Previous...)
+}
+
+func (epochs *memoryEpochs) Epoch(userID string) (int64, error) {
+	epochs.mutex.RLock()
+	defer epochs.mutex.RUnlock()
+	return epochs.epochs[userID], nil
+}
+
+func (epochs *memoryEpochs) Increment(userID string) error {
+	epochs.mutex.Lock()
+	defer epochs.mutex.Unlock()
+	epochs.epochs[userID]++
+	return nil
+}
+
+func CookieSessionDel(app *forest.App, manager *CookieSessionManager,
+	opts ...Option) func(ctx *bear.Context) {
+	o := newOptions(opts)
+	return func(ctx *bear.Context) {
+		o.setCookie(app, ctx, "", 0)
+		sessionID, _ := ctx.Get(forest.SessionID).(string)
+		userID, _ := ctx.Get(forest.SessionUserID).(string)
+		o.observe(SessionDeleted, sessionID, userID, ctx)
+		ctx.Next()
+	}
+}
+
+func CookieSessionGet(app *forest.App, manager *CookieSessionManager,
+	opts ...Option) func(ctx *bear.Context) {
+	o := newOptions(opts)
+	return func(ctx *bear.Context) {
+		prefix := o.tenantPrefix(ctx.Request)
+		// The session cookie is only written for a request that carries no
+		// token, or carries it in the session cookie.
+		token, fromCookie := o.token(ctx.Request)
+		writeCookie := token == "" || fromCookie
+		createEmptySession := func(sessionID string, reset bool) {
+			if reset {
+				o.observe(SessionCreatedEmpty, sessionID, "", ctx)
+			} else {
+				o.observe(SessionResumed, sessionID, "", ctx)
+			}
+			if reset && writeCookie {
+				duration := app.Duration("Cookie")
+				value, err := manager.Encode(prefix.key(sessionID),
+					"", "", duration)
+				if err != nil {
+					o.logger.Error("error encoding session",
+						logArgs(ctx, sessionID, err)...)
+				} else {
+					o.setCookie(app, ctx, value, duration)
+				}
+			}
+			manager.CreateEmpty(sessionID, ctx)
+			ctx.Next()
+		}
+		if token == "" {
+			createEmptySession(uuid.New(), true)
+			return
+		}
+		session, err := manager.decodeTenant(token, prefix)
+		if err != nil || session == nil {
+			o.observe(SessionInvalid, "", "", ctx)
+			createEmptySession(uuid.New(), true)
+			return
+		}
+		if session.UserID == "" || session.UserJSON == "" {
+			createEmptySession(session.SessionID, false)
+			return
+		}
+		// A cookie is never refreshed past its absolute timeout; once that
+		// has elapsed, the user must authenticate again.
+		if session.Created != 0 {
+			created := time.Unix(session.Created, 0)
+			if o.absoluteTimeout > 0 &&
+				!o.clock.Now().Before(created.Add(o.absoluteTimeout)) {
+				o.observe(SessionExpired, session.SessionID, session.UserID, ctx)
+				createEmptySession(uuid.New(), true)
+				return
+			}
+			ctx.Set(sessionOrigin,
+				&origin{created: created, userID: session.UserID})
+		}
+		err = manager.Create(session.SessionID,
+			session.UserID, session.UserJSON, ctx)
+		if err != nil {
+			o.logger.Error("error creating session",
+				logArgs(ctx, session.SessionID, err)...)
+			o.observe(SessionInvalid, session.SessionID, session.UserID, ctx)
+			createEmptySession(uuid.New(), true)
+			return
+		}
+		o.observe(SessionResumed, session.SessionID, session.UserID, ctx)
+		// If SessionRefresh is set to false, the session will not refresh;
+		// if it's not set or if it's set to true, the session is refreshed.
+		refresh, ok := ctx.Get(forest.SessionRefresh).(bool)
+		if (!ok || refresh) && writeCookie {
+			value, err := o.encodeCookie(app, ctx, manager,
+				session.SessionID, session.UserID, session.UserJSON)
+			if err != nil {
+				o.logger.Error("error encoding session",
+					logArgs(ctx, session.SessionID, err)...)
+			} else {
+				o.setCookie(app, ctx, value, app.Duration("Cookie"))
+				o.observe(SessionRefreshed, session.SessionID,
+					session.UserID, ctx)
+			}
+		}
+		ctx.Next()
+	}
+}
+
+// CookieSessionRevoke revokes every cookie issued to forest.SessionUserID by
+// incrementing the user's epoch. If keepCurrent is true, the cookie of the
+// session making the request is reissued at the new epoch, so it is kept.
+func CookieSessionRevoke(app *forest.App, manager *CookieSessionManager,
+	keepCurrent bool, opts ...Option) func(ctx *bear.Context) {
+	o := newOptions(opts)
+	return func(ctx *bear.Context) {
+		userID, ok := ctx.Get(forest.SessionUserID).(string)
+		if !ok || userID == "" {
+			message := safeErrorMessage(app, ctx, app.Error("Unauthorized"))
+			logResponse(o, ctx, http.StatusUnauthorized)
+			app.Response(ctx, http.StatusUnauthorized,
+				forest.Failure, message).Write(nil)
+			return
+		}
+		sessionID, ok := ctx.Get(forest.SessionID).(string)
+		if keepCurrent && !ok {
+			err := fmt.Errorf("CookieSessionRevoke %s: %v",
+				forest.SessionID, ctx.Get(forest.SessionID))
+			ctx.Set(forest.Error, err)
+			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
+			app.Response(ctx, http.StatusInternalServerError,
+				forest.Failure, message).Write(nil)
+			return
+		}
+		prefix := o.tenantPrefix(ctx.Request)
+		if err := manager.Revoke(prefix.key(userID)); err != nil {
+			ctx.Set(forest.Error, err)
+			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
+			app.Response(ctx, http.StatusInternalServerError,
+				forest.Failure, message).Write(nil)
+			return
+		}
+		if keepCurrent {
+			userJSON, err := manager.Marshal(ctx)
+			var value string
+			if err == nil {
+				value, err = o.encodeCookie(app, ctx, manager, sessionID,
+					userID, string(userJSON))
+			}
+			if err != nil {
+				ctx.Set(forest.Error, err)
+				message := safeErrorMessage(app, ctx, app.Error("Generic"))
+				logResponse(o, ctx, http.StatusInternalServerError)
+				app.Response(ctx, http.StatusInternalServerError,
+					forest.Failure, message).Write(nil)
+				return
+			}
+			o.setCookie(app, ctx, value, app.Duration("Cookie"))
+		}
+		o.observe(SessionRevoked, sessionID, userID, ctx)
+		ctx.Next()
+	}
+}
+
+func CookieSessionSet(app *forest.App, manager *CookieSessionManager,
+	opts ...Option) func(ctx *bear.Context) {
+	o := newOptions(opts)
+	return func(ctx *bear.Context) {
+		userJSON, err := manager.Marshal(ctx)
+		if err != nil {
+			ctx.Set(forest.Error, err)
+			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
+			app.Response(ctx, http.StatusInternalServerError,
+				forest.Failure, message).Write(nil)
+			return
+		}
+		sessionID, ok := ctx.Get(forest.SessionID).(string)
+		if !ok {
+			err := fmt.Errorf("%s: %v",
+				forest.SessionID, ctx.Get(forest.SessionID))
+			ctx.Set(forest.Error, err)
+			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
+			app.Response(ctx, http.StatusInternalServerError,
+				forest.Failure, message).Write(nil)
+			return
+		}
+		userID, ok := ctx.Get(forest.SessionUserID).(string)
+		if !ok {
+			err := fmt.Errorf("%s: %v",
+				forest.SessionUserID, ctx.Get(forest.SessionUserID))
+			ctx.Set(forest.Error, err)
+			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
+			app.Response(ctx, http.StatusInternalServerError,
+				forest.Failure, message).Write(nil)
+			return
+		}
+		value, err := o.encodeCookie(app, ctx, manager, sessionID, userID,
+			string(userJSON))
+		if err != nil {
+			ctx.Set(forest.Error, err)
+			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
+			app.Response(ctx, http.StatusInternalServerError,
+				forest.Failure, message).Write(nil)
+			return
+		}
+		o.setCookie(app, ctx, value, app.Duration("Cookie"))
+		o.observe(SessionAuthenticated, sessionID, userID, ctx)
+		ctx.Next()
+	}
+}
+
+// encodeCookie encodes the session of userID for the tenant of ctx. If the
+// request resumed a cookie of the same user, the new cookie keeps its
+// creation time, and it never outlives the absolute timeout.
+func (o *options) encodeCookie(app *forest.App, ctx *bear.Context,
+	manager *CookieSessionManager, sessionID string, userID string,
+	userJSON string) (string, error) {
+	prefix := o.tenantPrefix(ctx.Request)
+	created := o.clock.Now()
+	if resumed, _ := ctx.Get(sessionOrigin).(*origin); resumed != nil &&
+		resumed.userID == userID {
+		created = resumed.created
+	}
+	duration := o.sessionDuration(app)
+	if o.absoluteTimeout > 0 {
+		remaining := created.Add(o.absoluteTimeout).Sub(o.clock.Now())
+		if remaining < duration {
+			duration = remaining
+		}
+	}
+	return manager.encode(&cookieSession{
+		Created:   created.Unix(),
+		SessionID: prefix.key(sessionID),
+		UserID:    prefix.key(userID),
+		UserJSON:  userJSON}, duration)
+}
+
+// signedCodec authenticates, but does not hide, cookie payloads with
+// HMAC-SHA256.
+type signedCodec struct{ keys Keyring }
+
+func (codec *signedCodec) open(value string) []byte {
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 {
+		return nil
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+	for _, key := range codec.keys.all() {
+		if hmac.Equal(signature, sign(key, parts[0])) {
+			payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+			if err != nil {
+				return nil
+			}
+			return payload
+		}
+	}
+	return nil
+}
+
+func (codec *signedCodec) seal(payload []byte) (string, error) {
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	signature := sign(codec.keys.Current, encoded)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func sign(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
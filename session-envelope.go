@@ -0,0 +1,138 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ursiform/bear"
+)
+
+// sessionOrigin is set in a bear.Context by SessionGet to an *origin.
+const sessionOrigin = "sessionorigin"
+
+// Migration upgrades the userJSON of a session by one version.
+type Migration func(userJSON []byte) ([]byte, error)
+
+// Migrations holds the Migration that upgrades userJSON from each version.
+type Migrations map[int]Migration
+
+// envelope wraps userJSON when a session carries more than the user.
+type envelope struct {
+	Wares *envelopeMeta   `json:"$wares"`
+	User  json.RawMessage `json:"user,omitempty"`
+}
+
+// envelopeMeta is what an envelope holds besides the user. Created is when,
+// in Unix nanoseconds, the user's session was first created, if it was since
+// stored under a new ID, which the SessionManager does not know about.
+type envelopeMeta struct {
+	Created int64   `json:"created,omitempty"`
+	Flashes []Flash `json:"flashes,omitempty"`
+	Version int     `json:"version,omitempty"`
+}
+
+// origin records when the session of a user was first created. It outlives
+// the ID of the session, which changes when it is regenerated, so that
+// WithAbsoluteTimeout cannot be evaded by regenerating a session.
+type origin struct {
+	created time.Time
+	userID  string
+}
+
+// WithMigrations stamps the userJSON stored by the session wares with
+// version, and makes SessionGet upgrade a session stored with an older version
+// before passing it to SessionManager.Create, by applying migrations[v] for
+// each version v from the stored one up to version. Sessions stored before
+// versioning was enabled are version 0. A session that cannot be upgraded,
+// including one stored by a newer version, is treated as invalid. The cookie
+// session wares do not support versioning.
+func WithMigrations(version int, migrations Migrations) Option {
+	return func(o *options) {
+		o.migrations = migrations
+		o.version = version
+	}
+}
+
+// migrate upgrades userJSON from version to o.version.
+func (o *options) migrate(userJSON string, version int) (string, error) {
+	if version > o.version {
+		return "", fmt.Errorf("session version %d is newer than %d",
+			version, o.version)
+	}
+	migrated := []byte(userJSON)
+	for ; version < o.version; version++ {
+		migration, ok := o.migrations[version]
+		if !ok {
+			return "", fmt.Errorf("no migration from version %d", version)
+		}
+		var err error
+		if migrated, err = migration(migrated); err != nil {
+			return "", fmt.Errorf("migration from version %d: %v",
+				version, err)
+		}
+	}
+	return string(migrated), nil
+}
+
+// openEnvelope returns the user JSON held by userJSON, along with the flash
+// messages and version stored with it. A userJSON that is not an envelope is
+// returned as is, with no flash messages, as version 0.
+func openEnvelope(userJSON string) (string, envelopeMeta) {
+	wrapped := new(envelope)
+	err := json.Unmarshal([]byte(userJSON), wrapped)
+	if err != nil || wrapped.Wares == nil {
+		return userJSON, envelopeMeta{}
+	}
+	return string(wrapped.User), *wrapped.Wares
+}
+
+// seal wraps the userJSON of userID in an envelope along with flashes, the
+// version, and, if the absolute timeout is enforced and the request resumed a
+// session of the same user, when that session was first created.
+func (o *options) seal(ctx *bear.Context, userID string, userJSON []byte,
+	flashes []Flash) (string, error) {
+	meta := envelopeMeta{Flashes: flashes, Version: o.version}
+	resumed, _ := ctx.Get(sessionOrigin).(*origin)
+	if o.absoluteTimeout > 0 && resumed != nil && resumed.userID == userID {
+		meta.Created = resumed.created.UnixNano()
+	}
+	return sealEnvelope(userJSON, meta)
+}
+
+// setOrigin records when the session of userID read by SessionGet was first
+// created, which is the earlier of when it was stored and when the session it
+// replaced was, and returns it.
+func setOrigin(ctx *bear.Context, info *SessionInfo,
+	meta envelopeMeta) time.Time {
+	created := info.Created
+	if meta.Created != 0 {
+		replaced := time.Unix(0, meta.Created)
+		if created.IsZero() || replaced.Before(created) {
+			created = replaced
+		}
+	}
+	if !created.IsZero() {
+		ctx.Set(sessionOrigin, &origin{created: created, userID: info.UserID})
+	}
+	return created
+}
+
+// sealEnvelope wraps userJSON in an envelope if there is anything in meta to
+// store along with it.
+func sealEnvelope(userJSON []byte, meta envelopeMeta) (string, error) {
+	if meta.Created == 0 && len(meta.Flashes) == 0 && meta.Version == 0 {
+		return string(userJSON), nil
+	}
+	sealed, err := json.Marshal(&envelope{
+		Wares: &meta,
+		User:  json.RawMessage(userJSON)})
+	if err != nil {
+		return "", err
+	}
+	return string(sealed), nil
+}
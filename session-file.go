@@ -0,0 +1,383 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fileSessionExtension = ".session"
+	fileTemporaryPrefix  = ".tmp-"
+)
+
+type FileConfig struct {
+	// Clock defaults to the system clock.
+	Clock Clock
+	// Dir is the directory sessions are persisted to, one file per session.
+	// It is created if it does not exist.
+	Dir string
+	// NewUser is passed through to the embedded SessionBinder.
+	NewUser func() interface{}
+	// SweepInterval is how often expired session files are removed; it
+	// defaults to one minute.
+	SweepInterval time.Duration
+}
+
+// FileSessionManager is a SessionManager that persists sessions to a
+// directory so that they survive process restarts. Each session is written
+// atomically (to a temporary file that is synced and renamed into place), so
+// a crash never leaves a partially written session behind. It is safe for
+// concurrent use within a single process. Close stops background eviction.
+type FileSessionManager struct {
+	SessionBinder
+	clock    Clock
+	dir      string
+	done     chan struct{}
+	mutex    sync.RWMutex
+	once     sync.Once
+	sessions map[string]*fileIndexEntry
+	users    map[string]map[string]bool
+}
+
+type fileIndexEntry struct {
+	expires time.Time
+	userID  string
+}
+
+type fileSession struct {
+	Created     time.Time `json:"created"`
+	Expires     time.Time `json:"expires"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	IP          string    `json:"ip,omitempty"`
+	LastSeen    time.Time `json:"lastseen"`
+	SessionID   string    `json:"sessionid"`
+	UserAgent   string    `json:"useragent,omitempty"`
+	UserID      string    `json:"userid"`
+	UserJSON    string    `json:"userjson"`
+}
+
+func NewFileSessionManager(config *FileConfig) (*FileSessionManager, error) {
+	if config == nil || config.Dir == "" {
+		return nil, errors.New("NewFileSessionManager: Dir is required")
+	}
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("NewFileSessionManager: %s", err)
+	}
+	interval := config.SweepInterval
+	if interval <= 0 {
+		interval = defaultSweepInterval
+	}
+	manager := &FileSessionManager{
+		SessionBinder: SessionBinder{NewUser: config.NewUser},
+		clock:         clockOrSystem(config.Clock),
+		dir:           config.Dir,
+		done:          make(chan struct{}),
+		sessions:      make(map[string]*fileIndexEntry),
+		users:         make(map[string]map[string]bool)}
+	if err := manager.rebuildIndex(); err != nil {
+		return nil, fmt.Errorf("NewFileSessionManager: %s", err)
+	}
+	go manager.sweep(interval)
+	return manager, nil
+}
+
+func (manager *FileSessionManager) Close() error {
+	manager.once.Do(func() { close(manager.done) })
+	return nil
+}
+
+func (manager *FileSessionManager) Delete(sessionID string,
+	userID string) error {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	return manager.remove(sessionID)
+}
+
+func (manager *FileSessionManager) ListSessions(
+	userID string) ([]*SessionInfo, error) {
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+	now := manager.clock.Now()
+	sessions := make([]*SessionInfo, 0, len(manager.users[userID]))
+	for sessionID := range manager.users[userID] {
+		session, err := manager.load(manager.path(sessionID))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !session.Expires.After(now) {
+			continue
+		}
+		sessions = append(sessions, &SessionInfo{
+			Created:     session.Created,
+			Expires:     session.Expires,
+			Fingerprint: session.Fingerprint,
+			IP:          session.IP,
+			LastSeen:    session.LastSeen,
+			SessionID:   sessionID,
+			UserAgent:   session.UserAgent,
+			UserID:      session.UserID,
+			UserJSON:    session.UserJSON})
+	}
+	return sessions, nil
+}
+
+func (manager *FileSessionManager) Read(sessionID string) (userID string,
+	userJSON string, err error) {
+	info, err := manager.ReadInfo(sessionID)
+	if info == nil {
+		return "", "", err
+	}
+	return info.UserID, info.UserJSON, nil
+}
+
+func (manager *FileSessionManager) ReadInfo(
+	sessionID string) (*SessionInfo, error) {
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+	session, err := manager.load(manager.path(sessionID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := manager.clock.Now()
+	if session.SessionID != sessionID || !session.Expires.After(now) {
+		return nil, nil
+	}
+	return &SessionInfo{
+		Created:     session.Created,
+		Expires:     session.Expires,
+		Fingerprint: session.Fingerprint,
+		IP:          session.IP,
+		LastSeen:    session.LastSeen,
+		SessionID:   sessionID,
+		UserAgent:   session.UserAgent,
+		UserID:      session.UserID,
+		UserJSON:    session.UserJSON}, nil
+}
+
+func (manager *FileSessionManager) Revoke(userID string) error {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	for sessionID := range manager.users[userID] {
+		if err := manager.remove(sessionID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (manager *FileSessionManager) SetFingerprint(sessionID string,
+	fingerprint string) error {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	session, err := manager.load(manager.path(sessionID))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if session.SessionID != sessionID || session.Fingerprint != "" {
+		return nil
+	}
+	session.Fingerprint = fingerprint
+	return manager.write(session)
+}
+
+func (manager *FileSessionManager) Touch(sessionID string, ip string,
+	userAgent string) error {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	session, err := manager.load(manager.path(sessionID))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if session.SessionID != sessionID {
+		return nil
+	}
+	session.IP = ip
+	session.LastSeen = manager.clock.Now()
+	session.UserAgent = userAgent
+	return manager.write(session)
+}
+
+func (manager *FileSessionManager) Update(sessionID string, userID string,
+	userJSON string, duration time.Duration) error {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	if duration <= 0 {
+		return manager.remove(sessionID)
+	}
+	now := manager.clock.Now()
+	session := &fileSession{
+		Created:   now,
+		Expires:   now.Add(duration),
+		SessionID: sessionID,
+		UserID:    userID,
+		UserJSON:  userJSON}
+	if existing, err := manager.load(manager.path(sessionID)); err == nil &&
+		existing.SessionID == sessionID {
+		session.Created = existing.Created
+		session.Fingerprint = existing.Fingerprint
+		session.IP = existing.IP
+		session.LastSeen = existing.LastSeen
+		session.UserAgent = existing.UserAgent
+	}
+	if err := manager.write(session); err != nil {
+		return err
+	}
+	manager.index(session)
+	return nil
+}
+
+// index must be called while holding the write lock.
+func (manager *FileSessionManager) index(session *fileSession) {
+	manager.unindex(session.SessionID)
+	manager.sessions[session.SessionID] = &fileIndexEntry{
+		expires: session.Expires,
+		userID:  session.UserID}
+	if manager.users[session.UserID] == nil {
+		manager.users[session.UserID] = make(map[string]bool)
+	}
+	manager.users[session.UserID][session.SessionID] = true
+}
+
+func (manager *FileSessionManager) load(path string) (*fileSession, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	session := new(fileSession)
+	if err := json.Unmarshal(data, session); err != nil {
+		return nil, fmt.Errorf("%s: %s", filepath.Base(path), err)
+	}
+	return session, nil
+}
+
+// path maps a session ID to a file name that is safe to use regardless of
+// the characters in the session ID.
+func (manager *FileSessionManager) path(sessionID string) string {
+	return filepath.Join(manager.dir,
+		sha256Hex([]byte(sessionID))+fileSessionExtension)
+}
+
+// rebuildIndex rebuilds the index from disk, discarding temporary files left by
+// interrupted writes as well as corrupt and expired sessions.
+func (manager *FileSessionManager) rebuildIndex() error {
+	entries, err := os.ReadDir(manager.dir)
+	if err != nil {
+		return err
+	}
+	now := manager.clock.Now()
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(manager.dir, name)
+		if strings.HasPrefix(name, fileTemporaryPrefix) {
+			os.Remove(path)
+			continue
+		}
+		if entry.IsDir() || filepath.Ext(name) != fileSessionExtension {
+			continue
+		}
+		session, err := manager.load(path)
+		if err != nil || path != manager.path(session.SessionID) ||
+			!session.Expires.After(now) {
+			os.Remove(path)
+			continue
+		}
+		manager.index(session)
+	}
+	return nil
+}
+
+// remove must be called while holding the write lock.
+func (manager *FileSessionManager) remove(sessionID string) error {
+	manager.unindex(sessionID)
+	err := os.Remove(manager.path(sessionID))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (manager *FileSessionManager) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-manager.done:
+			return
+		case <-ticker.C:
+			manager.mutex.Lock()
+			now := manager.clock.Now()
+			for sessionID, entry := range manager.sessions {
+				if !entry.expires.After(now) {
+					manager.remove(sessionID)
+				}
+			}
+			manager.mutex.Unlock()
+		}
+	}
+}
+
+// unindex must be called while holding the write lock.
+func (manager *FileSessionManager) unindex(sessionID string) {
+	entry, ok := manager.sessions[sessionID]
+	if !ok {
+		return
+	}
+	delete(manager.sessions, sessionID)
+	delete(manager.users[entry.userID], sessionID)
+	if len(manager.users[entry.userID]) == 0 {
+		delete(manager.users, entry.userID)
+	}
+}
+
+func (manager *FileSessionManager) write(session *fileSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(manager.dir, fileTemporaryPrefix)
+	if err != nil {
+		return err
+	}
+	temporary := file.Name()
+	if _, err = file.Write(data); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temporary, manager.path(session.SessionID))
+	}
+	if err != nil {
+		os.Remove(temporary)
+		return err
+	}
+	// Sync the directory so the rename itself is durable.
+	if dir, err := os.Open(manager.dir); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ursiform/bear"
+	"github.com/ursiform/forest"
+)
+
+const (
+	// Flashes is the bear.Context key FlashGet sets to the []Flash delivered
+	// to a request.
+	Flashes = "flashes"
+	// flashQueue holds the []Flash added to a bear.Context by AddFlash.
+	flashQueue = "flashqueue"
+	// sessionDeleted is set in a bear.Context to true by SessionDel.
+	sessionDeleted = "sessiondeleted"
+	// sessionFlashes holds the []Flash read from a session by SessionGet
+	// until FlashGet delivers them.
+	sessionFlashes = "sessionflashes"
+)
+
+// Flash is a one-shot message stored in a session until it is delivered by
+// FlashGet. Kind distinguishes messages, e.g. "error" or "success".
+type Flash struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// AddFlash queues a flash message in the current request. It is stored in
+// the session by FlashSet or SessionSet and delivered by FlashGet on a later
+// request.
+func AddFlash(ctx *bear.Context, flash Flash) {
+	queue, _ := ctx.Get(flashQueue).([]Flash)
+	ctx.Set(flashQueue, append(queue, flash))
+}
+
+// FlashGet sets Flashes to the flash messages stored in the session read by
+// SessionGet and removes them from the session, so they are delivered once.
+func FlashGet(app *forest.App, manager SessionManager,
+	opts ...Option) func(ctx *bear.Context) {
+	o := newOptions(opts)
+	return func(ctx *bear.Context) {
+		if rejectCookieManager(app, o, ctx, manager) {
+			return
+		}
+		manager := o.namespace(ctx.Request, manager)
+		store := NewContextSessionManager(manager)
+		flashes, _ := ctx.Get(sessionFlashes).([]Flash)
+		if len(flashes) == 0 {
+			ctx.Next()
+			return
+		}
+		ctx.Set(Flashes, flashes)
+		ctx.Set(sessionFlashes, nil)
+		if err := saveFlashes(ctx, store, o, app); err != nil {
+			ctx.Set(forest.Error, err)
+			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
+			app.Response(ctx, http.StatusInternalServerError,
+				forest.Failure, message).Write(nil)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// FlashSet stores the flash messages added with AddFlash in the session. It
+// is only needed on routes that do not end with SessionSet, which stores them
+// as well. For an anonymous visitor, or after SessionDel, it stores a session
+// that holds only the flash messages.
+func FlashSet(app *forest.App, manager SessionManager,
+	opts ...Option) func(ctx *bear.Context) {
+	o := newOptions(opts)
+	return func(ctx *bear.Context) {
+		if rejectCookieManager(app, o, ctx, manager) {
+			return
+		}
+		manager := o.namespace(ctx.Request, manager)
+		store := NewContextSessionManager(manager)
+		if queue, _ := ctx.Get(flashQueue).([]Flash); len(queue) == 0 {
+			ctx.Next()
+			return
+		}
+		if err := saveFlashes(ctx, store, o, app); err != nil {
+			ctx.Set(forest.Error, err)
+			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
+			app.Response(ctx, http.StatusInternalServerError,
+				forest.Failure, message).Write(nil)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// pendingFlashes returns the flash messages that have not been delivered,
+// followed by those added to the current request.
+func pendingFlashes(ctx *bear.Context) []Flash {
+	stored, _ := ctx.Get(sessionFlashes).([]Flash)
+	queue, _ := ctx.Get(flashQueue).([]Flash)
+	return append(append([]Flash(nil), stored...), queue...)
+}
+
+// saveFlashes stores the session with its pending flash messages, or deletes
+// it if it is anonymous and no flash messages remain.
+func saveFlashes(ctx *bear.Context, store ContextSessionManager,
+	o *options, app *forest.App) error {
+	sessionID, ok := ctx.Get(forest.SessionID).(string)
+	if !ok {
+		return fmt.Errorf("%s: %v", forest.SessionID, ctx.Get(forest.SessionID))
+	}
+	userID, _ := ctx.Get(forest.SessionUserID).(string)
+	var userJSON []byte
+	if deleted, _ := ctx.Get(sessionDeleted).(bool); deleted {
+		userID = ""
+	} else if userID != "" {
+		var err error
+		if userJSON, err = store.Marshal(ctx); err != nil {
+			return err
+		}
+	}
+	flashes := pendingFlashes(ctx)
+	if userID == "" && len(flashes) == 0 {
+		return store.DeleteContext(ctx.Request.Context(), sessionID, userID)
+	}
+	sealed, err := o.seal(ctx, userID, userJSON, flashes)
+	if err != nil {
+		return err
+	}
+	err = store.UpdateContext(ctx.Request.Context(), sessionID, userID,
+		sealed, o.sessionDuration(app))
+	if err != nil {
+		return err
+	}
+	ctx.Set(flashQueue, nil)
+	if pending, _ := ctx.Get(sessionPending).(bool); pending {
+		ctx.Set(sessionPending, false)
+		o.setCookie(app, ctx, sessionID, app.Duration("Cookie"))
+	}
+	return nil
+}
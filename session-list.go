@@ -0,0 +1,136 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/ursiform/bear"
+	"github.com/ursiform/forest"
+)
+
+// sessionListItem is how SessionList renders a session. Session IDs are
+// credentials, so a session is identified by a hash of its ID instead.
+type sessionListItem struct {
+	Created   time.Time `json:"created"`
+	Current   bool      `json:"current"`
+	Expires   time.Time `json:"expires"`
+	ID        string    `json:"id"`
+	IP        string    `json:"ip,omitempty"`
+	LastSeen  time.Time `json:"lastseen"`
+	UserAgent string    `json:"useragent,omitempty"`
+}
+
+// SessionDelByID deletes the session of forest.SessionUserID whose id, as
+// rendered by SessionList, is in the "id" route parameter. It responds with
+// http.StatusNotFound if the user has no such session.
+func SessionDelByID(app *forest.App, manager SessionManager,
+	opts ...Option) func(ctx *bear.Context) {
+	o := newOptions(opts)
+	return func(ctx *bear.Context) {
+		if rejectCookieManager(app, o, ctx, manager) {
+			return
+		}
+		manager := o.namespace(ctx.Request, manager)
+		store := NewContextSessionManager(manager)
+		sessions, ok := listSessions(app, manager, o, ctx)
+		if !ok {
+			return
+		}
+		id := ctx.Params["id"]
+		for _, session := range sessions {
+			if sha256Hex([]byte(session.SessionID)) != id {
+				continue
+			}
+			if err := store.DeleteContext(ctx.Request.Context(),
+				session.SessionID, session.UserID); err != nil {
+				ctx.Set(forest.Error, err)
+				message := safeErrorMessage(app, ctx, app.Error("Generic"))
+				logResponse(o, ctx, http.StatusInternalServerError)
+				app.Response(ctx, http.StatusInternalServerError,
+					forest.Failure, message).Write(nil)
+				return
+			}
+			o.observe(SessionDeleted, session.SessionID, session.UserID, ctx)
+			ctx.Next()
+			return
+		}
+		message := safeErrorMessage(app, ctx, app.Error("NotFound"))
+		logResponse(o, ctx, http.StatusNotFound)
+		app.Response(ctx, http.StatusNotFound,
+			forest.Failure, message).Write(nil)
+	}
+}
+
+// SessionList responds with the sessions of forest.SessionUserID, most
+// recently created first.
+func SessionList(app *forest.App, manager SessionManager,
+	opts ...Option) func(ctx *bear.Context) {
+	o := newOptions(opts)
+	return func(ctx *bear.Context) {
+		if rejectCookieManager(app, o, ctx, manager) {
+			return
+		}
+		manager := o.namespace(ctx.Request, manager)
+		sessions, ok := listSessions(app, manager, o, ctx)
+		if !ok {
+			return
+		}
+		sort.Slice(sessions, func(i, j int) bool {
+			return sessions[i].Created.After(sessions[j].Created)
+		})
+		current, _ := ctx.Get(forest.SessionID).(string)
+		items := make([]*sessionListItem, len(sessions))
+		for i, session := range sessions {
+			items[i] = &sessionListItem{
+				Created:   session.Created,
+				Current:   session.SessionID == current,
+				Expires:   session.Expires,
+				ID:        sha256Hex([]byte(session.SessionID)),
+				IP:        session.IP,
+				LastSeen:  session.LastSeen,
+				UserAgent: session.UserAgent}
+		}
+		app.Response(ctx, http.StatusOK,
+			forest.Success, forest.NoMessage).Write(items)
+	}
+}
+
+// listSessions lists the sessions of forest.SessionUserID. If it fails, it
+// writes an error response and returns false.
+func listSessions(app *forest.App, manager SessionManager, o *options,
+	ctx *bear.Context) ([]*SessionInfo, bool) {
+	userID, ok := ctx.Get(forest.SessionUserID).(string)
+	if !ok || userID == "" {
+		message := safeErrorMessage(app, ctx, app.Error("Unauthorized"))
+		logResponse(o, ctx, http.StatusUnauthorized)
+		app.Response(ctx, http.StatusUnauthorized,
+			forest.Failure, message).Write(nil)
+		return nil, false
+	}
+	lister, ok := Extension[SessionLister](manager)
+	if !ok {
+		err := fmt.Errorf("%T does not implement SessionLister", manager)
+		ctx.Set(forest.Error, err)
+		message := safeErrorMessage(app, ctx, app.Error("Generic"))
+		logResponse(o, ctx, http.StatusInternalServerError)
+		app.Response(ctx, http.StatusInternalServerError,
+			forest.Failure, message).Write(nil)
+		return nil, false
+	}
+	sessions, err := lister.ListSessions(userID)
+	if err != nil {
+		ctx.Set(forest.Error, err)
+		message := safeErrorMessage(app, ctx, app.Error("Generic"))
+		logResponse(o, ctx, http.StatusInternalServerError)
+		app.Response(ctx, http.StatusInternalServerError,
+			forest.Failure, message).Write(nil)
+		return nil, false
+	}
+	return sessions, true
+}
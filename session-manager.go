@@ -5,6 +5,7 @@
 package wares
 
 import (
+	"context"
 	"time"
 
 	"github.com/ursiform/bear"
@@ -27,3 +28,142 @@ type SessionManager interface {
 		userJSON string,
 		duration time.Duration) error
 }
+
+// SessionInfo describes a stored session. Created is when the session was
+// first stored with Update; Expires is when it will expire unless refreshed.
+// IP, LastSeen, and UserAgent describe the client that last used the session,
+// and Fingerprint the client it is bound to, for stores that record them.
+type SessionInfo struct {
+	Created     time.Time
+	Expires     time.Time
+	Fingerprint string
+	IP          string
+	LastSeen    time.Time
+	SessionID   string
+	UserAgent   string
+	UserID      string
+	UserJSON    string
+}
+
+// SessionInfoReader is an optional extension of SessionManager. ReadInfo
+// returns nil (and no error) if a session does not exist or has expired.
+// The session wares use it in place of Read when it is available, which is
+// required to enforce absolute session timeouts.
+type SessionInfoReader interface {
+	ReadInfo(sessionID string) (*SessionInfo, error)
+}
+
+// SessionLister is an optional extension of SessionManager that enumerates
+// the unexpired sessions belonging to a user, in no particular order. It is
+// required to enforce WithSessionLimit.
+type SessionLister interface {
+	ListSessions(userID string) ([]*SessionInfo, error)
+}
+
+// SessionFingerprinter is an optional extension of SessionManager that binds
+// a session to a client fingerprint, which is returned in SessionInfo. A
+// session that is already bound keeps its original fingerprint.
+type SessionFingerprinter interface {
+	SetFingerprint(sessionID string, fingerprint string) error
+}
+
+// SessionToucher is an optional extension of SessionManager that records the
+// client using a session, along with the time, so that they are returned in
+// SessionInfo. The session wares call Touch whenever they store a session,
+// and SessionGet whenever it reads one, at most once a minute per session
+// unless its client changes, so LastSeen may lag by up to a minute.
+type SessionToucher interface {
+	Touch(sessionID string, ip string, userAgent string) error
+}
+
+// sessionWrapper is implemented by the SessionManagers in this package that
+// wrap another. Such a wrapper implements every optional extension, but only
+// supports those that the manager it wraps supports.
+type sessionWrapper interface {
+	unwrap() SessionManager
+}
+
+// Extension returns manager as E if it supports the optional extension E.
+// The SessionManagers in this package that wrap another, such as
+// CachedSessionManager, implement every extension but only support those of
+// the manager they wrap, so use Extension rather than a type assertion.
+func Extension[E any](manager SessionManager) (E, bool) {
+	ext, ok := manager.(E)
+	for ok {
+		wrapper, wraps := manager.(sessionWrapper)
+		if !wraps {
+			break
+		}
+		manager = wrapper.unwrap()
+		_, ok = manager.(E)
+	}
+	return ext, ok
+}
+
+// ContextSessionManager is a SessionManager whose store operations accept a
+// context.Context, so that they can be cancelled when a client disconnects or
+// bounded by a deadline. The session wares pass ctx.Request.Context().
+type ContextSessionManager interface {
+	SessionManager
+	DeleteContext(c context.Context, sessionID string, userID string) error
+	ReadContext(c context.Context,
+		sessionID string) (userID string, userJSON string, err error)
+	RevokeContext(c context.Context, userID string) error
+	UpdateContext(
+		c context.Context,
+		sessionID string,
+		userID string,
+		userJSON string,
+		duration time.Duration) error
+}
+
+// ContextSessionInfoReader is the context-aware form of SessionInfoReader.
+type ContextSessionInfoReader interface {
+	ReadInfoContext(c context.Context, sessionID string) (*SessionInfo, error)
+}
+
+// NewContextSessionManager returns manager if it is already a
+// ContextSessionManager. Otherwise, it wraps manager in an adapter that
+// returns the context's error instead of calling manager once the context is
+// done; a call that is already in progress is not interrupted.
+func NewContextSessionManager(manager SessionManager) ContextSessionManager {
+	if manager, ok := manager.(ContextSessionManager); ok {
+		return manager
+	}
+	return contextAdapter{manager}
+}
+
+type contextAdapter struct{ SessionManager }
+
+func (adapter contextAdapter) DeleteContext(c context.Context,
+	sessionID string, userID string) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	return adapter.Delete(sessionID, userID)
+}
+
+func (adapter contextAdapter) ReadContext(c context.Context,
+	sessionID string) (userID string, userJSON string, err error) {
+	if err := c.Err(); err != nil {
+		return "", "", err
+	}
+	return adapter.Read(sessionID)
+}
+
+func (adapter contextAdapter) RevokeContext(c context.Context,
+	userID string) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	return adapter.Revoke(userID)
+}
+
+func (adapter contextAdapter) UpdateContext(c context.Context,
+	sessionID string, userID string, userJSON string,
+	duration time.Duration) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	return adapter.Update(sessionID, userID, userJSON, duration)
+}
@@ -0,0 +1,224 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultSweepInterval = time.Minute
+
+type MemoryConfig struct {
+	// Clock defaults to the system clock.
+	Clock Clock
+	// NewUser is passed through to the embedded SessionBinder.
+	NewUser func() interface{}
+	// SweepInterval is how often expired sessions are evicted; it defaults
+	// to one minute.
+	SweepInterval time.Duration
+}
+
+// MemorySessionManager is a SessionManager that keeps sessions in process
+// memory. It is safe for concurrent use. Close stops background eviction.
+type MemorySessionManager struct {
+	SessionBinder
+	clock    Clock
+	done     chan struct{}
+	mutex    sync.RWMutex
+	once     sync.Once
+	sessions map[string]*memorySession
+	users    map[string]map[string]bool
+}
+
+type memorySession struct {
+	created     time.Time
+	expires     time.Time
+	fingerprint string
+	ip          string
+	lastSeen    time.Time
+	userAgent   string
+	userID      string
+	userJSON    string
+}
+
+func NewMemorySessionManager(config *MemoryConfig) *MemorySessionManager {
+	if config == nil {
+		config = new(MemoryConfig)
+	}
+	interval := config.SweepInterval
+	if interval <= 0 {
+		interval = defaultSweepInterval
+	}
+	manager := &MemorySessionManager{
+		SessionBinder: SessionBinder{NewUser: config.NewUser},
+		clock:         clockOrSystem(config.Clock),
+		done:          make(chan struct{}),
+		sessions:      make(map[string]*memorySession),
+		users:         make(map[string]map[string]bool)}
+	go manager.sweep(interval)
+	return manager
+}
+
+func (manager *MemorySessionManager) Close() error {
+	manager.once.Do(func() { close(manager.done) })
+	return nil
+}
+
+func (manager *MemorySessionManager) Delete(sessionID string,
+	userID string) error {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	manager.remove(sessionID)
+	return nil
+}
+
+func (manager *MemorySessionManager) ListSessions(
+	userID string) ([]*SessionInfo, error) {
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+	now := manager.clock.Now()
+	sessions := make([]*SessionInfo, 0, len(manager.users[userID]))
+	for sessionID := range manager.users[userID] {
+		session := manager.sessions[sessionID]
+		if !session.expires.After(now) {
+			continue
+		}
+		sessions = append(sessions, &SessionInfo{
+			Created:     session.created,
+			Expires:     session.expires,
+			Fingerprint: session.fingerprint,
+			IP:          session.ip,
+			LastSeen:    session.lastSeen,
+			SessionID:   sessionID,
+			UserAgent:   session.userAgent,
+			UserID:      session.userID,
+			UserJSON:    session.userJSON})
+	}
+	return sessions, nil
+}
+
+func (manager *MemorySessionManager) Read(sessionID string) (userID string,
+	userJSON string, err error) {
+	info, err := manager.ReadInfo(sessionID)
+	if info == nil {
+		return "", "", err
+	}
+	return info.UserID, info.UserJSON, nil
+}
+
+func (manager *MemorySessionManager) ReadInfo(
+	sessionID string) (*SessionInfo, error) {
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+	session, ok := manager.sessions[sessionID]
+	if !ok || !session.expires.After(manager.clock.Now()) {
+		return nil, nil
+	}
+	return &SessionInfo{
+		Created:     session.created,
+		Expires:     session.expires,
+		Fingerprint: session.fingerprint,
+		IP:          session.ip,
+		LastSeen:    session.lastSeen,
+		SessionID:   sessionID,
+		UserAgent:   session.userAgent,
+		UserID:      session.userID,
+		UserJSON:    session.userJSON}, nil
+}
+
+func (manager *MemorySessionManager) Revoke(userID string) error {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	for sessionID := range manager.users[userID] {
+		manager.remove(sessionID)
+	}
+	return nil
+}
+
+func (manager *MemorySessionManager) SetFingerprint(sessionID string,
+	fingerprint string) error {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	if session, ok := manager.sessions[sessionID]; ok &&
+		session.fingerprint == "" {
+		session.fingerprint = fingerprint
+	}
+	return nil
+}
+
+func (manager *MemorySessionManager) Touch(sessionID string, ip string,
+	userAgent string) error {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	if session, ok := manager.sessions[sessionID]; ok {
+		session.ip = ip
+		session.lastSeen = manager.clock.Now()
+		session.userAgent = userAgent
+	}
+	return nil
+}
+
+func (manager *MemorySessionManager) Update(sessionID string, userID string,
+	userJSON string, duration time.Duration) error {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	now := manager.clock.Now()
+	updated := &memorySession{
+		created:  now,
+		expires:  now.Add(duration),
+		userID:   userID,
+		userJSON: userJSON}
+	if session, ok := manager.sessions[sessionID]; ok {
+		updated.created = session.created
+		updated.fingerprint = session.fingerprint
+		updated.ip = session.ip
+		updated.lastSeen = session.lastSeen
+		updated.userAgent = session.userAgent
+		manager.remove(sessionID)
+	}
+	if duration <= 0 {
+		return nil
+	}
+	manager.sessions[sessionID] = updated
+	if manager.users[userID] == nil {
+		manager.users[userID] = make(map[string]bool)
+	}
+	manager.users[userID][sessionID] = true
+	return nil
+}
+
+// remove must be called while holding the write lock.
+func (manager *MemorySessionManager) remove(sessionID string) {
+	session, ok := manager.sessions[sessionID]
+	if !ok {
+		return
+	}
+	delete(manager.sessions, sessionID)
+	delete(manager.users[session.userID], sessionID)
+	if len(manager.users[session.userID]) == 0 {
+		delete(manager.users, session.userID)
+	}
+}
+
+func (manager *MemorySessionManager) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-manager.done:
+			return
+		case <-ticker.C:
+			manager.mutex.Lock()
+			now := manager.clock.Now()
+			for sessionID, session := range manager.sessions {
+				if !session.expires.After(now) {
+					manager.remove(sessionID)
+				}
+			}
+			manager.mutex.Unlock()
+		}
+	}
+}
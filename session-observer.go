@@ -0,0 +1,87 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares
+
+import "github.com/ursiform/bear"
+
+// SessionEvent is a change in the state of a session reported to a
+// SessionObserver.
+type SessionEvent int
+
+const (
+	// SessionCreatedEmpty is observed by SessionGet when it gives a request
+	// a new anonymous session.
+	SessionCreatedEmpty SessionEvent = iota
+	// SessionResumed is observed by SessionGet when a request carries a
+	// valid session, including an anonymous one that holds flash messages.
+	SessionResumed
+	// SessionRefreshed is observed by SessionGet after it extends the
+	// lifetime of a resumed session.
+	SessionRefreshed
+	// SessionInvalid is observed by SessionGet when a request carries a
+	// session that does not exist, cannot be decoded, or is bound to a
+	// different client. A session that has merely expired is
+	// indistinguishable from one that never existed.
+	SessionInvalid
+	// SessionExpired is observed by SessionGet when a session has reached its
+	// absolute timeout.
+	SessionExpired
+	// SessionAuthenticated is observed by SessionSet and SessionRegenerate
+	// after they store a user's session.
+	SessionAuthenticated
+	// SessionDeleted is observed by SessionDel and SessionDelByID after they
+	// delete a session.
+	SessionDeleted
+	// SessionRevoked is observed by SessionRevoke after it revokes a user's
+	// sessions; the session ID is that of the request that revoked them.
+	SessionRevoked
+)
+
+var sessionEventNames = [...]string{
+	SessionCreatedEmpty:  "created empty",
+	SessionResumed:       "resumed",
+	SessionRefreshed:     "refreshed",
+	SessionInvalid:       "invalid",
+	SessionExpired:       "expired",
+	SessionAuthenticated: "authenticated",
+	SessionDeleted:       "deleted",
+	SessionRevoked:       "revoked"}
+
+func (event SessionEvent) String() string {
+	if event < 0 || int(event) >= len(sessionEventNames) {
+		return "unknown"
+	}
+	return sessionEventNames[event]
+}
+
+// SessionObserver is notified of session events by the session wares and by
+// their cookie counterparts. It is called synchronously, before the next ware
+// runs, so it should not block; userID is empty for an anonymous session.
+type SessionObserver interface {
+	ObserveSession(event SessionEvent, sessionID string, userID string,
+		ctx *bear.Context)
+}
+
+// SessionObserverFunc adapts a function to a SessionObserver.
+type SessionObserverFunc func(event SessionEvent, sessionID string,
+	userID string, ctx *bear.Context)
+
+func (observe SessionObserverFunc) ObserveSession(event SessionEvent,
+	sessionID string, userID string, ctx *bear.Context) {
+	observe(event, sessionID, userID, ctx)
+}
+
+// WithObserver adds a SessionObserver to the session wares. Observers are
+// notified in the order they were added.
+func WithObserver(observer SessionObserver) Option {
+	return func(o *options) { o.observers = append(o.observers, observer) }
+}
+
+func (o *options) observe(event SessionEvent, sessionID string,
+	userID string, ctx *bear.Context) {
+	for _, observer := range o.observers {
+		observer.ObserveSession(event, sessionID, userID, ctx)
+	}
+}
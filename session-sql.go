@@ -0,0 +1,424 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSQLTable = "sessions"
+	// sqlSchemaVersion is the version of the sessions table that Migrate
+	// creates or upgrades an older table to.
+	sqlSchemaVersion = 1
+)
+
+// SQLDialect selects the statements SQLSessionManager issues where databases
+// disagree on syntax, i.e. for upserts and for creating indexes.
+type SQLDialect int
+
+const (
+	// DialectSQLite also suits other databases that support "ON CONFLICT"
+	// upserts and "CREATE INDEX IF NOT EXISTS".
+	DialectSQLite SQLDialect = iota
+	DialectPostgres
+	DialectMySQL
+)
+
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type SQLConfig struct {
+	// Clock defaults to the system clock.
+	Clock Clock
+	// DB is an open handle for any database/sql driver.
+	DB *sql.DB
+	// Dialect defaults to DialectSQLite.
+	Dialect SQLDialect
+	// NewUser is passed through to the embedded SessionBinder.
+	NewUser func() interface{}
+	// Placeholder returns the bind parameter for the nth (starting at 1)
+	// argument of a query. It defaults to DollarPlaceholder for
+	// DialectPostgres and to QuestionPlaceholder otherwise.
+	Placeholder func(n int) string
+	// PurgeInterval, if positive, is how often expired sessions are purged in
+	// the background. Purge may also be called directly.
+	PurgeInterval time.Duration
+	// Table is the name of the sessions table; it defaults to "sessions".
+	Table string
+}
+
+// SQLSessionManager is a ContextSessionManager backed by a database/sql table
+// that it creates, along with an index on user ID, the first time it is used.
+// The versions of the schema applied to the table are recorded in a second
+// table, named after the first with a "_schema" suffix, so that later versions
+// of this package can upgrade the table in place. Times are
+// stored as Unix nanoseconds so the schema is portable across drivers. Close
+// stops background purging; it does not close DB.
+type SQLSessionManager struct {
+	SessionBinder
+	clock      Clock
+	db         *sql.DB
+	done       chan struct{}
+	migrated   bool
+	migrations [][]string
+	mutex      sync.Mutex
+	once       sync.Once
+	queries    map[string]string
+}
+
+func DollarPlaceholder(n int) string { return "$" + strconv.Itoa(n) }
+
+func QuestionPlaceholder(n int) string { return "?" }
+
+func NewSQLSessionManager(config *SQLConfig) (*SQLSessionManager, error) {
+	if config == nil || config.DB == nil {
+		return nil, errors.New("NewSQLSessionManager: DB is required")
+	}
+	table := config.Table
+	if table == "" {
+		table = defaultSQLTable
+	}
+	if !sqlIdentifier.MatchString(table) {
+		return nil, fmt.Errorf("NewSQLSessionManager: invalid table %q", table)
+	}
+	placeholder := config.Placeholder
+	if placeholder == nil && config.Dialect == DialectPostgres {
+		placeholder = DollarPlaceholder
+	} else if placeholder == nil {
+		placeholder = QuestionPlaceholder
+	}
+	manager := &SQLSessionManager{
+		SessionBinder: SessionBinder{NewUser: config.NewUser},
+		clock:         clockOrSystem(config.Clock),
+		db:            config.DB,
+		done:          make(chan struct{}),
+		migrations:    sqlMigrations(table, config.Dialect),
+		queries:       sqlQueries(table, config.Dialect, placeholder)}
+	if config.PurgeInterval > 0 {
+		go manager.purge(config.PurgeInterval)
+	}
+	return manager, nil
+}
+
+func (manager *SQLSessionManager) Close() error {
+	manager.once.Do(func() { close(manager.done) })
+	return nil
+}
+
+func (manager *SQLSessionManager) Delete(sessionID string,
+	userID string) error {
+	return manager.DeleteContext(context.Background(), sessionID, userID)
+}
+
+func (manager *SQLSessionManager) DeleteContext(c context.Context,
+	sessionID string, userID string) error {
+	if err := manager.migrate(c); err != nil {
+		return err
+	}
+	_, err := manager.db.ExecContext(c, manager.queries["delete"], sessionID)
+	return err
+}
+
+// ListSessions returns the unexpired sessions of userID.
+func (manager *SQLSessionManager) ListSessions(
+	userID string) ([]*SessionInfo, error) {
+	if err := manager.Migrate(); err != nil {
+		return nil, err
+	}
+	rows, err := manager.db.Query(manager.queries["list"],
+		userID, manager.clock.Now().UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var sessions []*SessionInfo
+	for rows.Next() {
+		var created, expires, lastSeen int64
+		info := new(SessionInfo)
+		err := rows.Scan(&info.SessionID, &info.UserID, &info.UserJSON,
+			&created, &expires, &info.IP, &info.UserAgent, &lastSeen,
+			&info.Fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		info.Created = time.Unix(0, created)
+		info.Expires = time.Unix(0, expires)
+		info.LastSeen = sqlTime(lastSeen)
+		sessions = append(sessions, info)
+	}
+	return sessions, rows.Err()
+}
+
+// Migrate creates the sessions table and its user ID index if they do not
+// exist, and upgrades a table created by an older version of this package.
+// It is called automatically before every other operation and only touches
+// the database until it first succeeds. Each version is applied in a
+// transaction, so a failed upgrade is retried whole on the next operation;
+// MySQL commits schema changes regardless, so every step is also safe to
+// repeat.
+func (manager *SQLSessionManager) Migrate() error {
+	return manager.migrate(context.Background())
+}
+
+// Purge deletes all expired sessions and reports how many were removed.
+func (manager *SQLSessionManager) Purge() (int64, error) {
+	if err := manager.Migrate(); err != nil {
+		return 0, err
+	}
+	result, err := manager.db.Exec(manager.queries["purge"],
+		manager.clock.Now().UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (manager *SQLSessionManager) Read(sessionID string) (userID string,
+	userJSON string, err error) {
+	return manager.ReadContext(context.Background(), sessionID)
+}
+
+func (manager *SQLSessionManager) ReadContext(c context.Context,
+	sessionID string) (userID string, userJSON string, err error) {
+	info, err := manager.ReadInfoContext(c, sessionID)
+	if info == nil {
+		return "", "", err
+	}
+	return info.UserID, info.UserJSON, nil
+}
+
+func (manager *SQLSessionManager) ReadInfo(
+	sessionID string) (*SessionInfo, error) {
+	return manager.ReadInfoContext(context.Background(), sessionID)
+}
+
+func (manager *SQLSessionManager) ReadInfoContext(c context.Context,
+	sessionID string) (*SessionInfo, error) {
+	if err := manager.migrate(c); err != nil {
+		return nil, err
+	}
+	var created, expires, lastSeen int64
+	info := &SessionInfo{SessionID: sessionID}
+	row := manager.db.QueryRowContext(c, manager.queries["read"],
+		sessionID, manager.clock.Now().UnixNano())
+	err := row.Scan(&info.UserID, &info.UserJSON, &created, &expires,
+		&info.IP, &info.UserAgent, &lastSeen, &info.Fingerprint)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	info.Created = time.Unix(0, created)
+	info.Expires = time.Unix(0, expires)
+	info.LastSeen = sqlTime(lastSeen)
+	return info, nil
+}
+
+func (manager *SQLSessionManager) Revoke(userID string) error {
+	return manager.RevokeContext(context.Background(), userID)
+}
+
+func (manager *SQLSessionManager) RevokeContext(c context.Context,
+	userID string) error {
+	if err := manager.migrate(c); err != nil {
+		return err
+	}
+	_, err := manager.db.ExecContext(c, manager.queries["revoke"], userID)
+	return err
+}
+
+func (manager *SQLSessionManager) SetFingerprint(sessionID string,
+	fingerprint string) error {
+	if err := manager.Migrate(); err != nil {
+		return err
+	}
+	_, err := manager.db.Exec(manager.queries["fingerprint"],
+		fingerprint, sessionID)
+	return err
+}
+
+func (manager *SQLSessionManager) Touch(sessionID string, ip string,
+	userAgent string) error {
+	if err := manager.Migrate(); err != nil {
+		return err
+	}
+	_, err := manager.db.Exec(manager.queries["touch"],
+		ip, userAgent, manager.clock.Now().UnixNano(), sessionID)
+	return err
+}
+
+func (manager *SQLSessionManager) Update(sessionID string, userID string,
+	userJSON string, duration time.Duration) error {
+	return manager.UpdateContext(context.Background(),
+		sessionID, userID, userJSON, duration)
+}
+
+func (manager *SQLSessionManager) UpdateContext(c context.Context,
+	sessionID string, userID string, userJSON string,
+	duration time.Duration) error {
+	if duration <= 0 {
+		return manager.DeleteContext(c, sessionID, userID)
+	}
+	if err := manager.migrate(c); err != nil {
+		return err
+	}
+	// An existing session keeps its creation time and client metadata.
+	now := manager.clock.Now()
+	_, err := manager.db.ExecContext(c, manager.queries["upsert"],
+		sessionID, userID, userJSON, now.Add(duration).UnixNano(),
+		now.UnixNano(), "", "", 0, "")
+	return err
+}
+
+func (manager *SQLSessionManager) migrate(c context.Context) error {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	if manager.migrated {
+		return nil
+	}
+	if err := manager.upgrade(c); err != nil {
+		return fmt.Errorf("Migrate: %s", err)
+	}
+	manager.migrated = true
+	return nil
+}
+
+// step applies the migration to version, and records it, in a transaction.
+func (manager *SQLSessionManager) step(c context.Context, version int) error {
+	tx, err := manager.db.BeginTx(c, nil)
+	if err != nil {
+		return err
+	}
+	for _, statement := range manager.migrations[version-1] {
+		if _, err := tx.ExecContext(c, statement); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(c, manager.queries["record"],
+		version); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// upgrade applies the migrations newer than the version of the sessions
+// table, which is 0 if it does not exist.
+func (manager *SQLSessionManager) upgrade(c context.Context) error {
+	_, err := manager.db.ExecContext(c, manager.queries["schema"])
+	if err != nil {
+		return err
+	}
+	var version sql.NullInt64
+	err = manager.db.QueryRowContext(c, manager.queries["version"]).
+		Scan(&version)
+	if err != nil {
+		return err
+	}
+	for v := int(version.Int64) + 1; v <= sqlSchemaVersion; v++ {
+		if err := manager.step(c, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (manager *SQLSessionManager) purge(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-manager.done:
+			return
+		case <-ticker.C:
+			manager.Purge()
+		}
+	}
+}
+
+// sqlMigrations returns the statements that upgrade the sessions table from
+// each version to the next, starting from no table at all. Each must be safe
+// to repeat, because MySQL cannot roll schema changes back.
+func sqlMigrations(table string, dialect SQLDialect) [][]string {
+	create := "CREATE TABLE IF NOT EXISTS " + table + " (" +
+		"session_id VARCHAR(255) NOT NULL PRIMARY KEY, " +
+		"user_id VARCHAR(255) NOT NULL, " +
+		"user_json TEXT NOT NULL, " +
+		"expires_at BIGINT NOT NULL, " +
+		"created_at BIGINT NOT NULL, " +
+		"ip VARCHAR(255) NOT NULL DEFAULT '', " +
+		"user_agent TEXT NOT NULL, " +
+		"last_seen BIGINT NOT NULL DEFAULT 0, " +
+		"fingerprint VARCHAR(255) NOT NULL DEFAULT ''"
+	index := table + "_user_id"
+	// MySQL lacks "CREATE INDEX IF NOT EXISTS", so the index is declared
+	// along with the table instead.
+	if dialect == DialectMySQL {
+		return [][]string{{create + ", INDEX " + index + " (user_id))"}}
+	}
+	return [][]string{{create + ")",
+		"CREATE INDEX IF NOT EXISTS " + index + " ON " + table + " (user_id)"}}
+}
+
+func sqlQueries(table string, dialect SQLDialect,
+	placeholder func(n int) string) map[string]string {
+	bind := func(query string) string {
+		parts := strings.Split(query, "?")
+		for i := 1; i < len(parts); i++ {
+			parts[i] = placeholder(i) + parts[i]
+		}
+		return strings.Join(parts, "")
+	}
+	upsert := "INSERT INTO " + table + " (session_id, user_id, user_json, " +
+		"expires_at, created_at, ip, user_agent, last_seen, fingerprint) " +
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) "
+	if dialect == DialectMySQL {
+		upsert += "ON DUPLICATE KEY UPDATE user_id = VALUES(user_id), " +
+			"user_json = VALUES(user_json), expires_at = VALUES(expires_at)"
+	} else {
+		upsert += "ON CONFLICT (session_id) DO UPDATE SET " +
+			"user_id = excluded.user_id, user_json = excluded.user_json, " +
+			"expires_at = excluded.expires_at"
+	}
+	return map[string]string{
+		"delete": bind("DELETE FROM " + table + " WHERE session_id = ?"),
+		"fingerprint": bind("UPDATE " + table + " SET fingerprint = ? " +
+			"WHERE session_id = ? AND fingerprint = ''"),
+		"list": bind("SELECT session_id, user_id, user_json, created_at, " +
+			"expires_at, ip, user_agent, last_seen, fingerprint " +
+			"FROM " + table +
+			" WHERE user_id = ? AND expires_at > ?"),
+		"purge": bind("DELETE FROM " + table + " WHERE expires_at <= ?"),
+		"read": bind("SELECT user_id, user_json, created_at, expires_at, " +
+			"ip, user_agent, last_seen, fingerprint FROM " + table +
+			" WHERE session_id = ? AND expires_at > ?"),
+		"record": bind("INSERT INTO " + table + "_schema (version) " +
+			"VALUES (?)"),
+		"revoke": bind("DELETE FROM " + table + " WHERE user_id = ?"),
+		"schema": "CREATE TABLE IF NOT EXISTS " + table + "_schema " +
+			"(version INTEGER NOT NULL)",
+		"touch": bind("UPDATE " + table + " SET ip = ?, user_agent = ?, " +
+			"last_seen = ? WHERE session_id = ?"),
+		"upsert":  bind(upsert),
+		"version": "SELECT MAX(version) FROM " + table + "_schema"}
+}
+
+// sqlTime converts a stored Unix nanosecond time, where 0 means never, to a
+// time.Time.
+func sqlTime(nanoseconds int64) time.Time {
+	if nanoseconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanoseconds)
+}
@@ -0,0 +1,265 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TenantResolver returns the tenant a request belongs to. An empty tenant is
+// a tenant like any other.
+type TenantResolver func(request *http.Request) string
+
+// HeaderTenant resolves the tenant from the named request header.
+func HeaderTenant(name string) TenantResolver {
+	return func(request *http.Request) string {
+		return request.Header.Get(name)
+	}
+}
+
+// HostTenant resolves the tenant from the host a request was sent to,
+// without its port.
+func HostTenant() TenantResolver {
+	return func(request *http.Request) string {
+		host, _, err := net.SplitHostPort(request.Host)
+		if err != nil {
+			return strings.ToLower(request.Host)
+		}
+		return strings.ToLower(host)
+	}
+}
+
+// PathPrefixTenant resolves the tenant from the first segment of a request's
+// path, e.g. "acme" for "/acme/users".
+func PathPrefixTenant() TenantResolver {
+	return func(request *http.Request) string {
+		path := strings.TrimPrefix(request.URL.Path, "/")
+		if i := strings.Index(path, "/"); i >= 0 {
+			path = path[:i]
+		}
+		return path
+	}
+}
+
+// WithTenants namespaces sessions by the tenant resolve returns for each
+// request. The session wares store sessions and users under keys prefixed
+// with the tenant, and the session cookie name is suffixed with it, so a
+// session is only honored by the tenant it was created for. Session and user
+// IDs in a bear.Context, and those passed to a SessionObserver, are not
+// prefixed.
+func WithTenants(resolve TenantResolver) Option {
+	return func(o *options) { o.tenant = resolve }
+}
+
+// tenantPrefix is prepended to keys to namespace them by tenant. The tenant
+// is escaped so that it never contains the ":" that ends the prefix, which
+// keeps one tenant's keys from colliding with another's.
+type tenantPrefix string
+
+func newTenantPrefix(tenant string) tenantPrefix {
+	return tenantPrefix(url.QueryEscape(tenant) + ":")
+}
+
+// id returns the ID namespaced as key, or false if key belongs to a
+// different tenant.
+func (prefix tenantPrefix) id(key string) (string, bool) {
+	if key == "" {
+		return "", true
+	}
+	if !strings.HasPrefix(key, string(prefix)) {
+		return "", false
+	}
+	return key[len(prefix):], true
+}
+
+// key namespaces id. An empty ID, i.e. an anonymous user, stays empty.
+func (prefix tenantPrefix) key(id string) string {
+	if id == "" {
+		return ""
+	}
+	return string(prefix) + id
+}
+
+// tenantCookieSuffix returns the suffix of the session cookie name of tenant,
+// replacing the characters a cookie name may not contain.
+func tenantCookieSuffix(tenant string) string {
+	if tenant == "" {
+		return ""
+	}
+	return "_" + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, tenant)
+}
+
+// namespace returns manager as seen by the tenant of request, or manager
+// itself if tenants are not enabled.
+func (o *options) namespace(request *http.Request,
+	manager SessionManager) SessionManager {
+	if o.tenant == nil {
+		return manager
+	}
+	return &tenantManager{
+		SessionManager: manager,
+		prefix:         o.tenantPrefix(request),
+		store:          NewContextSessionManager(manager)}
+}
+
+// tenantPrefix returns the prefix that namespaces keys for the tenant of
+// request, which is empty, and leaves keys as they are, if tenants are not
+// enabled.
+func (o *options) tenantPrefix(request *http.Request) tenantPrefix {
+	if o.tenant == nil {
+		return ""
+	}
+	return newTenantPrefix(o.tenant(request))
+}
+
+// tenantManager namespaces the session and user IDs passed to the
+// SessionManager it wraps. Create, CreateEmpty, and Marshal, which only deal
+// with a bear.Context, are passed through as is. Like CachedSessionManager, it
+// only supports the optional extensions of the manager it wraps.
+type tenantManager struct {
+	SessionManager
+	prefix tenantPrefix
+	store  ContextSessionManager
+}
+
+func (manager *tenantManager) Delete(sessionID string, userID string) error {
+	return manager.DeleteContext(context.Background(), sessionID, userID)
+}
+
+func (manager *tenantManager) DeleteContext(c context.Context,
+	sessionID string, userID string) error {
+	return manager.store.DeleteContext(c,
+		manager.prefix.key(sessionID), manager.prefix.key(userID))
+}
+
+func (manager *tenantManager) ListSessions(
+	userID string) ([]*SessionInfo, error) {
+	lister, ok := manager.SessionManager.(SessionLister)
+	if !ok {
+		return nil, fmt.Errorf("%T does not implement SessionLister",
+			manager.SessionManager)
+	}
+	listed, err := lister.ListSessions(manager.prefix.key(userID))
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]*SessionInfo, 0, len(listed))
+	for _, info := range listed {
+		if info = manager.strip(info); info != nil {
+			sessions = append(sessions, info)
+		}
+	}
+	return sessions, nil
+}
+
+func (manager *tenantManager) Read(sessionID string) (userID string,
+	userJSON string, err error) {
+	return manager.ReadContext(context.Background(), sessionID)
+}
+
+func (manager *tenantManager) ReadContext(c context.Context,
+	sessionID string) (userID string, userJSON string, err error) {
+	userID, userJSON, err = manager.store.ReadContext(c,
+		manager.prefix.key(sessionID))
+	if err != nil {
+		return "", "", err
+	}
+	if userID, ok := manager.prefix.id(userID); ok {
+		return userID, userJSON, nil
+	}
+	return "", "", nil
+}
+
+func (manager *tenantManager) ReadInfo(
+	sessionID string) (*SessionInfo, error) {
+	return manager.ReadInfoContext(context.Background(), sessionID)
+}
+
+func (manager *tenantManager) ReadInfoContext(c context.Context,
+	sessionID string) (*SessionInfo, error) {
+	info, err := readSession(c, manager.SessionManager,
+		manager.prefix.key(sessionID))
+	if info == nil {
+		return nil, err
+	}
+	return manager.strip(info), nil
+}
+
+func (manager *tenantManager) Revoke(userID string) error {
+	return manager.RevokeContext(context.Background(), userID)
+}
+
+func (manager *tenantManager) RevokeContext(c context.Context,
+	userID string) error {
+	return manager.store.RevokeContext(c, manager.prefix.key(userID))
+}
+
+func (manager *tenantManager) SetFingerprint(sessionID string,
+	fingerprint string) error {
+	fingerprinter, ok := manager.SessionManager.(SessionFingerprinter)
+	if !ok {
+		return fmt.Errorf("%T does not implement SessionFingerprinter",
+			manager.SessionManager)
+	}
+	return fingerprinter.SetFingerprint(manager.prefix.key(sessionID),
+		fingerprint)
+}
+
+func (manager *tenantManager) Touch(sessionID string, ip string,
+	userAgent string) error {
+	toucher, ok := manager.SessionManager.(SessionToucher)
+	if !ok {
+		return fmt.Errorf("%T does not implement SessionToucher",
+			manager.SessionManager)
+	}
+	return toucher.Touch(manager.prefix.key(sessionID), ip, userAgent)
+}
+
+func (manager *tenantManager) Update(sessionID string, userID string,
+	userJSON string, duration time.Duration) error {
+	return manager.UpdateContext(context.Background(),
+		sessionID, userID, userJSON, duration)
+}
+
+func (manager *tenantManager) UpdateContext(c context.Context,
+	sessionID string, userID string, userJSON string,
+	duration time.Duration) error {
+	return manager.store.UpdateContext(c, manager.prefix.key(sessionID),
+		manager.prefix.key(userID), userJSON, duration)
+}
+
+func (manager *tenantManager) unwrap() SessionManager {
+	return manager.SessionManager
+}
+
+// strip returns a copy of info with its IDs no longer namespaced, or nil if
+// info belongs to a different tenant.
+func (manager *tenantManager) strip(info *SessionInfo) *SessionInfo {
+	sessionID, ok := manager.prefix.id(info.SessionID)
+	if !ok {
+		return nil
+	}
+	userID, ok := manager.prefix.id(info.UserID)
+	if !ok {
+		return nil
+	}
+	stripped := *info
+	stripped.SessionID = sessionID
+	stripped.UserID = userID
+	return &stripped
+}
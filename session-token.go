@@ -0,0 +1,66 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares
+
+import (
+	"net/http"
+	"strings"
+)
+
+const bearerPrefix = "Bearer "
+
+// TokenExtractor returns the session token carried by a request, or an empty
+// string if the request does not carry one. cookieName is the name of the
+// session cookie for the request, which depends on the cookie and tenant
+// options.
+type TokenExtractor func(request *http.Request, cookieName string) string
+
+// BearerExtractor reads a token from an "Authorization: Bearer" header.
+func BearerExtractor() TokenExtractor {
+	return func(request *http.Request, cookieName string) string {
+		header := request.Header.Get("Authorization")
+		if len(header) < len(bearerPrefix) ||
+			!strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+			return ""
+		}
+		return strings.TrimSpace(header[len(bearerPrefix):])
+	}
+}
+
+// CookieExtractor reads a token from the named cookie. To read the session
+// cookie, whatever its name, use SessionCookieExtractor.
+func CookieExtractor(name string) TokenExtractor {
+	return func(request *http.Request, cookieName string) string {
+		return SessionCookieExtractor()(request, name)
+	}
+}
+
+// SessionCookieExtractor reads a token from the session cookie. It is the
+// default extractor.
+func SessionCookieExtractor() TokenExtractor {
+	return func(request *http.Request, cookieName string) string {
+		cookie, err := request.Cookie(cookieName)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	}
+}
+
+// HeaderExtractor reads a token from the named request header.
+func HeaderExtractor(name string) TokenExtractor {
+	return func(request *http.Request, cookieName string) string {
+		return request.Header.Get(name)
+	}
+}
+
+// QueryExtractor reads a token from the named query string parameter. Tokens
+// in URLs tend to end up in logs and browser history, so prefer a header
+// where clients allow it.
+func QueryExtractor(param string) TokenExtractor {
+	return func(request *http.Request, cookieName string) string {
+		return request.URL.Query().Get(param)
+	}
+}
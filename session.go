@@ -5,22 +5,47 @@
 package wares
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 
 	"github.com/pborman/uuid"
 	"github.com/ursiform/bear"
 	"github.com/ursiform/forest"
 )
 
-func SessionDel(app *forest.App, manager SessionManager) func(ctx *bear.Context) {
+// ErrSessionLimit is the error SessionSet and SessionRegenerate fail with when
+// WithSessionLimit rejects a session.
+var ErrSessionLimit = errors.New("session limit reached")
+
+// errCookieManager is the error the wares for stored sessions fail with when
+// they are given a CookieSessionManager, which stores nothing, so that they
+// never silently lose a session. Use the CookieSession wares instead.
+var errCookieManager = errors.New(
+	"a CookieSessionManager requires the CookieSession wares")
+
+// sessionPending is set in a bear.Context to true while forest.SessionID
+// holds a lazily created session that has not been written yet.
+const sessionPending = "sessionpending"
+
+func SessionDel(app *forest.App, manager SessionManager,
+	opts ...Option) func(ctx *bear.Context) {
+	o := newOptions(opts)
 	return func(ctx *bear.Context) {
+		if rejectCookieManager(app, o, ctx, manager) {
+			return
+		}
+		manager := o.namespace(ctx.Request, manager)
+		store := NewContextSessionManager(manager)
 		sessionID, ok := ctx.Get(forest.SessionID).(string)
 		if !ok {
 			err := fmt.Errorf("SessionDel %s: %v",
 				forest.SessionID, ctx.Get(forest.SessionID))
 			ctx.Set(forest.Error, err)
 			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
 			app.Response(ctx, http.StatusInternalServerError,
 				forest.Failure, message).Write(nil)
 			return
@@ -31,86 +56,353 @@ func SessionDel(app *forest.App, manager SessionManager) func(ctx *bear.Context)
 				forest.SessionUserID, ctx.Get(forest.SessionUserID))
 			ctx.Set(forest.Error, err)
 			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
 			app.Response(ctx, http.StatusInternalServerError,
 				forest.Failure, message).Write(nil)
 			return
 		}
-		if err := manager.Delete(sessionID, userID); err != nil {
+		// A lazily created session was never stored, so there is nothing to
+		// delete.
+		if pending, _ := ctx.Get(sessionPending).(bool); pending {
+			ctx.Next()
+			return
+		}
+		if err := store.DeleteContext(ctx.Request.Context(), sessionID,
+			userID); err != nil {
 			ctx.Set(forest.Error, err)
 			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
 			app.Response(ctx, http.StatusInternalServerError,
 				forest.Failure, message).Write(nil)
 			return
 		}
+		ctx.Set(sessionDeleted, true)
+		o.observe(SessionDeleted, sessionID, userID, ctx)
 		ctx.Next()
 	}
 }
 
-func SessionGet(app *forest.App, manager SessionManager) func(ctx *bear.Context) {
+func SessionGet(app *forest.App, manager SessionManager,
+	opts ...Option) func(ctx *bear.Context) {
+	o := newOptions(opts)
 	return func(ctx *bear.Context) {
-		cookieName := forest.SessionID
+		if rejectCookieManager(app, o, ctx, manager) {
+			return
+		}
+		manager := o.namespace(ctx.Request, manager)
+		store := NewContextSessionManager(manager)
+		// The session cookie is only written for a request that carries no
+		// token, or carries it in the session cookie.
+		sessionID, fromCookie := o.token(ctx.Request)
+		writeCookie := sessionID == "" || fromCookie
 		createEmptySession := func(sessionID string) {
-			path := app.Config.CookiePath
-			if path == "" {
-				path = "/"
+			o.observe(SessionCreatedEmpty, sessionID, "", ctx)
+			if o.lazy {
+				ctx.Set(forest.SessionID, sessionID)
+				ctx.Set(sessionPending, true)
+				ctx.Next()
+				return
 			}
-			cookieValue := sessionID
-			duration := app.Duration("Cookie")
 			// Reset the cookie.
-			app.SetCookie(ctx, path, cookieName, cookieValue, duration)
-			manager.CreateEmpty(sessionID, ctx)
+			if writeCookie {
+				o.setCookie(app, ctx, sessionID, app.Duration("Cookie"))
+			}
+			store.CreateEmpty(sessionID, ctx)
 			ctx.Next()
 		}
-		cookie, err := ctx.Request.Cookie(cookieName)
-		if err != nil || cookie.Value == "" {
+		if sessionID == "" {
 			createEmptySession(uuid.New())
 			return
 		}
-		sessionID := cookie.Value
-		userID, userJSON, err := manager.Read(sessionID)
-		if err != nil || userID == "" || userJSON == "" {
+		info, err := readSession(ctx.Request.Context(), manager, sessionID)
+		if err != nil || info == nil || info.UserJSON == "" {
+			o.observe(SessionInvalid, sessionID, "", ctx)
 			createEmptySession(uuid.New())
 			return
 		}
-		if err := manager.Create(sessionID, userID, userJSON, ctx); err != nil {
-			println(fmt.Sprintf("error creating session: %s", err))
+		user, meta := openEnvelope(info.UserJSON)
+		flashes := meta.Flashes
+		if len(flashes) > 0 {
+			ctx.Set(sessionFlashes, flashes)
+		}
+		if info.UserID == "" || user == "" {
+			if len(flashes) == 0 {
+				createEmptySession(uuid.New())
+				return
+			}
+			// An anonymous session is only stored to hold flash messages.
+			store.CreateEmpty(sessionID, ctx)
+			o.observe(SessionResumed, sessionID, "", ctx)
+			ctx.Next()
+			return
+		}
+		userID, userJSON := info.UserID, info.UserJSON
+		// A session stored by an older version is upgraded, and stored again
+		// once it is refreshed. One that cannot be upgraded is not honored,
+		// but it is left intact in case it was stored by a newer version.
+		if meta.Version != o.version {
+			if user, err = o.migrate(user, meta.Version); err == nil {
+				meta.Version = o.version
+				userJSON, err = sealEnvelope([]byte(user), meta)
+			}
+			if err != nil {
+				o.logger.Error("error migrating session",
+					logArgs(ctx, sessionID, err)...)
+				o.observe(SessionInvalid, sessionID, userID, ctx)
+				createEmptySession(uuid.New())
+				return
+			}
+		}
+		// A session bound to a different client, or not bound at all, is
+		// either not honored or only reported, depending on the binding mode.
+		if o.binding != nil && bindable(manager) {
+			fingerprint := o.binding.fingerprint(ctx.Request)
+			if fingerprint != info.Fingerprint {
+				if o.binding.onMismatch != nil {
+					o.binding.onMismatch(ctx, info, fingerprint)
+				}
+				if o.binding.mode == BindingStrict {
+					o.observe(SessionInvalid, sessionID, userID, ctx)
+					createEmptySession(uuid.New())
+					return
+				}
+			}
+		}
+		sessionDuration := o.sessionDuration(app)
+		// A session is never refreshed past its absolute timeout; once that
+		// has elapsed, the user must authenticate again.
+		created := setOrigin(ctx, info, meta)
+		if o.absoluteTimeout > 0 && !created.IsZero() {
+			remaining := created.Add(o.absoluteTimeout).Sub(o.clock.Now())
+			if remaining <= 0 {
+				if err := store.DeleteContext(ctx.Request.Context(), sessionID,
+					userID); err != nil {
+					o.logger.Error("error deleting session",
+						logArgs(ctx, sessionID, err)...)
+				}
+				o.observe(SessionExpired, sessionID, userID, ctx)
+				createEmptySession(uuid.New())
+				return
+			}
+			if remaining < sessionDuration {
+				sessionDuration = remaining
+			}
+		}
+		if err := store.Create(sessionID, userID, user, ctx); err != nil {
+			o.logger.Error("error creating session",
+				logArgs(ctx, sessionID, err)...)
 			defer func(sessionID string, userID string) {
-				if err := manager.Delete(sessionID, userID); err != nil {
-					println(fmt.Sprintf("error deleting session: %s", err))
+				if err := store.DeleteContext(ctx.Request.Context(), sessionID,
+					userID); err != nil {
+					o.logger.Error("error deleting session",
+						logArgs(ctx, sessionID, err)...)
 				}
 			}(sessionID, userID)
+			o.observe(SessionInvalid, sessionID, userID, ctx)
 			createEmptySession(uuid.New())
 			return
 		}
+		o.observe(SessionResumed, sessionID, userID, ctx)
 		// If SessionRefresh is set to false, the session will not refresh;
 		// if it's not set or if it's set to true, the session is refreshed.
 		refresh, ok := ctx.Get(forest.SessionRefresh).(bool)
-		if !ok || refresh {
-			path := app.Config.CookiePath
-			if path == "" {
-				path = "/"
-			}
-			cookieName := forest.SessionID
-			cookieValue := sessionID
-			duration := app.Duration("Cookie")
+		refreshed := false
+		if (!ok || refresh) && o.shouldRefresh(info, sessionDuration) {
 			// Refresh the cookie.
-			app.SetCookie(ctx, path, cookieName, cookieValue, duration)
-			err := manager.Update(sessionID, userID,
-				userJSON, app.Duration("Session"))
+			if writeCookie {
+				o.setCookie(app, ctx, sessionID, app.Duration("Cookie"))
+			}
+			err := store.UpdateContext(ctx.Request.Context(), sessionID,
+				userID, userJSON, sessionDuration)
 			if err != nil {
-				println(fmt.Sprintf("error updating session: %s", err))
+				o.logger.Error("error updating session",
+					logArgs(ctx, sessionID, err)...)
+			} else {
+				refreshed = true
+				o.observe(SessionRefreshed, sessionID, userID, ctx)
 			}
 		}
+		// A session is touched whenever it is read, but a session that is not
+		// refreshed is only touched as often as it needs to be.
+		if refreshed || o.shouldTouch(info, ctx.Request) {
+			touchSession(manager, o, ctx, sessionID)
+		}
 		ctx.Next()
 	}
 }
 
-func SessionSet(app *forest.App, manager SessionManager) func(ctx *bear.Context) {
+func SessionRegenerate(app *forest.App, manager SessionManager,
+	opts ...Option) func(ctx *bear.Context) {
+	o := newOptions(opts)
 	return func(ctx *bear.Context) {
-		userJSON, err := manager.Marshal(ctx)
+		if rejectCookieManager(app, o, ctx, manager) {
+			return
+		}
+		manager := o.namespace(ctx.Request, manager)
+		store := NewContextSessionManager(manager)
+		userJSON, err := store.Marshal(ctx)
 		if err != nil {
 			ctx.Set(forest.Error, err)
 			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
+			app.Response(ctx, http.StatusInternalServerError,
+				forest.Failure, message).Write(nil)
+			return
+		}
+		sessionID, ok := ctx.Get(forest.SessionID).(string)
+		if !ok {
+			err := fmt.Errorf("SessionRegenerate %s: %v",
+				forest.SessionID, ctx.Get(forest.SessionID))
+			ctx.Set(forest.Error, err)
+			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
+			app.Response(ctx, http.StatusInternalServerError,
+				forest.Failure, message).Write(nil)
+			return
+		}
+		userID, ok := ctx.Get(forest.SessionUserID).(string)
+		if !ok {
+			err := fmt.Errorf("SessionRegenerate %s: %v",
+				forest.SessionUserID, ctx.Get(forest.SessionUserID))
+			ctx.Set(forest.Error, err)
+			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
+			app.Response(ctx, http.StatusInternalServerError,
+				forest.Failure, message).Write(nil)
+			return
+		}
+		// The regenerated session replaces sessionID, so sessionID does not
+		// count against the limit.
+		err = limitSessions(ctx.Request.Context(), manager, o, sessionID, userID)
+		if err == ErrSessionLimit {
+			ctx.Set(forest.Error, err)
+			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusConflict)
+			app.Response(ctx, http.StatusConflict,
+				forest.Failure, message).Write(nil)
+			return
+		} else if err != nil {
+			ctx.Set(forest.Error, err)
+			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
+			app.Response(ctx, http.StatusInternalServerError,
+				forest.Failure, message).Write(nil)
+			return
+		}
+		sealed, err := o.seal(ctx, userID, userJSON, pendingFlashes(ctx))
+		if err != nil {
+			ctx.Set(forest.Error, err)
+			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
+			app.Response(ctx, http.StatusInternalServerError,
+				forest.Failure, message).Write(nil)
+			return
+		}
+		// Store the session under a fresh ID before dropping the old one, so
+		// an ID that was known before a privilege change is never honored
+		// after it.
+		regeneratedID := uuid.New()
+		if err := store.UpdateContext(ctx.Request.Context(), regeneratedID,
+			userID, sealed, o.sessionDuration(app)); err != nil {
+			ctx.Set(forest.Error, err)
+			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
+			app.Response(ctx, http.StatusInternalServerError,
+				forest.Failure, message).Write(nil)
+			return
+		}
+		ctx.Set(flashQueue, nil)
+		touchSession(manager, o, ctx, regeneratedID)
+		bindSession(manager, o, ctx, regeneratedID)
+		// A lazily created session was never stored, so there is nothing to
+		// delete.
+		if pending, _ := ctx.Get(sessionPending).(bool); !pending {
+			if err := store.DeleteContext(ctx.Request.Context(), sessionID,
+				userID); err != nil {
+				ctx.Set(forest.Error, err)
+				message := safeErrorMessage(app, ctx, app.Error("Generic"))
+				logResponse(o, ctx, http.StatusInternalServerError)
+				app.Response(ctx, http.StatusInternalServerError,
+					forest.Failure, message).Write(nil)
+				return
+			}
+		}
+		ctx.Set(forest.SessionID, regeneratedID)
+		ctx.Set(sessionPending, false)
+		o.setCookie(app, ctx, regeneratedID, app.Duration("Cookie"))
+		o.observe(SessionAuthenticated, regeneratedID, userID, ctx)
+		ctx.Next()
+	}
+}
+
+// SessionRevoke revokes every session belonging to forest.SessionUserID. If
+// keepCurrent is true, the session making the request is kept, which is how
+// "log out other devices" is implemented.
+func SessionRevoke(app *forest.App, manager SessionManager,
+	keepCurrent bool, opts ...Option) func(ctx *bear.Context) {
+	o := newOptions(opts)
+	return func(ctx *bear.Context) {
+		if rejectCookieManager(app, o, ctx, manager) {
+			return
+		}
+		manager := o.namespace(ctx.Request, manager)
+		store := NewContextSessionManager(manager)
+		userID, ok := ctx.Get(forest.SessionUserID).(string)
+		if !ok || userID == "" {
+			message := safeErrorMessage(app, ctx, app.Error("Unauthorized"))
+			logResponse(o, ctx, http.StatusUnauthorized)
+			app.Response(ctx, http.StatusUnauthorized,
+				forest.Failure, message).Write(nil)
+			return
+		}
+		sessionID, ok := ctx.Get(forest.SessionID).(string)
+		if keepCurrent && !ok {
+			err := fmt.Errorf("SessionRevoke %s: %v",
+				forest.SessionID, ctx.Get(forest.SessionID))
+			ctx.Set(forest.Error, err)
+			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
+			app.Response(ctx, http.StatusInternalServerError,
+				forest.Failure, message).Write(nil)
+			return
+		}
+		var err error
+		if keepCurrent {
+			err = revokeOthers(app, ctx, manager, o, sessionID, userID)
+		} else {
+			err = store.RevokeContext(ctx.Request.Context(), userID)
+		}
+		if err != nil {
+			ctx.Set(forest.Error, err)
+			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
+			app.Response(ctx, http.StatusInternalServerError,
+				forest.Failure, message).Write(nil)
+			return
+		}
+		if keepCurrent {
+			touchSession(manager, o, ctx, sessionID)
+			bindSession(manager, o, ctx, sessionID)
+		}
+		o.observe(SessionRevoked, sessionID, userID, ctx)
+		ctx.Next()
+	}
+}
+
+func SessionSet(app *forest.App, manager SessionManager,
+	opts ...Option) func(ctx *bear.Context) {
+	o := newOptions(opts)
+	return func(ctx *bear.Context) {
+		if rejectCookieManager(app, o, ctx, manager) {
+			return
+		}
+		manager := o.namespace(ctx.Request, manager)
+		store := NewContextSessionManager(manager)
+		userJSON, err := store.Marshal(ctx)
+		if err != nil {
+			ctx.Set(forest.Error, err)
+			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
 			app.Response(ctx, http.StatusInternalServerError,
 				forest.Failure, message).Write(nil)
 			return
@@ -121,6 +413,7 @@ func SessionSet(app *forest.App, manager SessionManager) func(ctx *bear.Context)
 				forest.SessionID, ctx.Get(forest.SessionID))
 			ctx.Set(forest.Error, err)
 			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
 			app.Response(ctx, http.StatusInternalServerError,
 				forest.Failure, message).Write(nil)
 			return
@@ -131,18 +424,248 @@ func SessionSet(app *forest.App, manager SessionManager) func(ctx *bear.Context)
 				forest.SessionUserID, ctx.Get(forest.SessionUserID))
 			ctx.Set(forest.Error, err)
 			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
+			app.Response(ctx, http.StatusInternalServerError,
+				forest.Failure, message).Write(nil)
+			return
+		}
+		err = limitSessions(ctx.Request.Context(), manager, o, sessionID, userID)
+		if err == ErrSessionLimit {
+			ctx.Set(forest.Error, err)
+			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusConflict)
+			app.Response(ctx, http.StatusConflict,
+				forest.Failure, message).Write(nil)
+			return
+		} else if err != nil {
+			ctx.Set(forest.Error, err)
+			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
+			app.Response(ctx, http.StatusInternalServerError,
+				forest.Failure, message).Write(nil)
+			return
+		}
+		sealed, err := o.seal(ctx, userID, userJSON, pendingFlashes(ctx))
+		if err != nil {
+			ctx.Set(forest.Error, err)
+			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
 			app.Response(ctx, http.StatusInternalServerError,
 				forest.Failure, message).Write(nil)
 			return
 		}
-		if err := manager.Update(sessionID, userID,
-			string(userJSON), app.Duration("Session")); err != nil {
+		if err := store.UpdateContext(ctx.Request.Context(), sessionID, userID,
+			sealed, o.sessionDuration(app)); err != nil {
 			ctx.Set(forest.Error, err)
 			message := safeErrorMessage(app, ctx, app.Error("Generic"))
+			logResponse(o, ctx, http.StatusInternalServerError)
 			app.Response(ctx, http.StatusInternalServerError,
 				forest.Failure, message).Write(nil)
 			return
 		}
+		ctx.Set(flashQueue, nil)
+		touchSession(manager, o, ctx, sessionID)
+		bindSession(manager, o, ctx, sessionID)
+		// A lazily created session gets its cookie once it has been stored.
+		if pending, _ := ctx.Get(sessionPending).(bool); pending {
+			ctx.Set(sessionPending, false)
+			o.setCookie(app, ctx, sessionID, app.Duration("Cookie"))
+		}
+		o.observe(SessionAuthenticated, sessionID, userID, ctx)
 		ctx.Next()
 	}
 }
+
+// rejectCookieManager writes an error response and returns true if manager
+// is, or wraps, a CookieSessionManager.
+func rejectCookieManager(app *forest.App, o *options, ctx *bear.Context,
+	manager SessionManager) bool {
+	for {
+		if _, ok := manager.(*CookieSessionManager); ok {
+			break
+		}
+		wrapper, ok := manager.(sessionWrapper)
+		if !ok {
+			return false
+		}
+		manager = wrapper.unwrap()
+	}
+	ctx.Set(forest.Error, errCookieManager)
+	message := safeErrorMessage(app, ctx, app.Error("Generic"))
+	logResponse(o, ctx, http.StatusInternalServerError)
+	app.Response(ctx, http.StatusInternalServerError,
+		forest.Failure, message).Write(nil)
+	return true
+}
+
+// limitSessions makes room for sessionID among userID's sessions according to
+// the limit in o. It returns ErrSessionLimit if the session is rejected.
+func limitSessions(c context.Context, manager SessionManager, o *options,
+	sessionID string, userID string) error {
+	lister, ok := Extension[SessionLister](manager)
+	if o.limit <= 0 || !ok {
+		return nil
+	}
+	if err := c.Err(); err != nil {
+		return err
+	}
+	sessions, err := lister.ListSessions(userID)
+	if err != nil {
+		return err
+	}
+	others := make([]*SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		if session.SessionID != sessionID {
+			others = append(others, session)
+		}
+	}
+	excess := len(others) - o.limit + 1
+	if excess <= 0 {
+		return nil
+	}
+	if o.limitPolicy != LimitEvictOldest {
+		return ErrSessionLimit
+	}
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].Created.Before(others[j].Created)
+	})
+	store := NewContextSessionManager(manager)
+	for _, session := range others[:excess] {
+		err := store.DeleteContext(c, session.SessionID, userID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revokeOthers revokes every session of userID but sessionID. If manager
+// implements SessionLister, the other sessions are deleted one by one, which
+// leaves sessionID untouched. Otherwise every session is revoked and sessionID
+// is stored again, bound to the fingerprint it was bound to before.
+func revokeOthers(app *forest.App, ctx *bear.Context, manager SessionManager,
+	o *options, sessionID string, userID string) error {
+	c := ctx.Request.Context()
+	store := NewContextSessionManager(manager)
+	if lister, ok := Extension[SessionLister](manager); ok {
+		if err := c.Err(); err != nil {
+			return err
+		}
+		sessions, err := lister.ListSessions(userID)
+		if err != nil {
+			return err
+		}
+		for _, session := range sessions {
+			if session.SessionID == sessionID {
+				continue
+			}
+			err := store.DeleteContext(c, session.SessionID, userID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	info, err := readSession(c, manager, sessionID)
+	if err != nil {
+		return err
+	}
+	userJSON, err := store.Marshal(ctx)
+	if err != nil {
+		return err
+	}
+	sealed, err := o.seal(ctx, userID, userJSON, pendingFlashes(ctx))
+	if err != nil {
+		return err
+	}
+	if err := store.RevokeContext(c, userID); err != nil {
+		return err
+	}
+	err = store.UpdateContext(c, sessionID, userID, sealed,
+		o.sessionDuration(app))
+	if err != nil {
+		return err
+	}
+	fingerprinter, ok := Extension[SessionFingerprinter](manager)
+	if ok && info != nil && info.Fingerprint != "" {
+		return fingerprinter.SetFingerprint(sessionID, info.Fingerprint)
+	}
+	return nil
+}
+
+// bindSession binds a session to the fingerprint of the current request if
+// binding is enabled and manager implements SessionFingerprinter. Failing to
+// do so is not fatal to the request.
+func bindSession(manager SessionManager, o *options, ctx *bear.Context,
+	sessionID string) {
+	fingerprinter, ok := Extension[SessionFingerprinter](manager)
+	if o.binding == nil || !ok {
+		return
+	}
+	fingerprint := o.binding.fingerprint(ctx.Request)
+	if err := fingerprinter.SetFingerprint(sessionID, fingerprint); err != nil {
+		o.logger.Error("error binding session",
+			logArgs(ctx, sessionID, err)...)
+	}
+}
+
+// bindable reports whether the sessions of manager can be bound to a client,
+// which requires storing their fingerprints and reading them back.
+func bindable(manager SessionManager) bool {
+	if _, ok := Extension[SessionFingerprinter](manager); !ok {
+		return false
+	}
+	if _, ok := Extension[ContextSessionInfoReader](manager); ok {
+		return true
+	}
+	_, ok := Extension[SessionInfoReader](manager)
+	return ok
+}
+
+// touchSession records the client using a session if manager implements
+// SessionToucher. Failing to do so is not fatal to the request.
+func touchSession(manager SessionManager, o *options, ctx *bear.Context,
+	sessionID string) {
+	toucher, ok := Extension[SessionToucher](manager)
+	if !ok {
+		return
+	}
+	err := toucher.Touch(sessionID, o.ip(ctx.Request), ctx.Request.UserAgent())
+	if err != nil {
+		o.logger.Error("error touching session",
+			logArgs(ctx, sessionID, err)...)
+	}
+}
+
+// readSession reads a session with ReadInfoContext or ReadInfo if manager
+// implements either, and with ReadContext otherwise. It returns nil if the
+// session does not exist; an anonymous session exists if it holds data, such
+// as flash messages.
+func readSession(c context.Context, manager SessionManager,
+	sessionID string) (*SessionInfo, error) {
+	if reader, ok := manager.(ContextSessionInfoReader); ok {
+		return reader.ReadInfoContext(c, sessionID)
+	}
+	if reader, ok := manager.(SessionInfoReader); ok {
+		if err := c.Err(); err != nil {
+			return nil, err
+		}
+		return reader.ReadInfo(sessionID)
+	}
+	userID, userJSON, err := NewContextSessionManager(manager).
+		ReadContext(c, sessionID)
+	if err != nil || (userID == "" && userJSON == "") {
+		return nil, err
+	}
+	return &SessionInfo{
+		SessionID: sessionID,
+		UserID:    userID,
+		UserJSON:  userJSON}, nil
+}
+
+func cookiePath(app *forest.App) string {
+	if app.Config.CookiePath == "" {
+		return "/"
+	}
+	return app.Config.CookiePath
+}
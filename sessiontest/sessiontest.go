@@ -0,0 +1,493 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+// Package sessiontest verifies that a wares.SessionManager honors the
+// contract the session wares rely on. Call Run from a test with a Config that
+// creates the manager under test:
+//
+//	func TestSessionManager(t *testing.T) {
+//		sessiontest.Run(t, sessiontest.Config{
+//			New: func(t *testing.T) wares.SessionManager {
+//				return newManager(t)
+//			}})
+//	}
+//
+// Run the tests with -race to verify that the manager is safe for concurrent
+// use. The optional extensions of SessionManager, such as SessionInfoReader,
+// are verified if the manager supports them, as reported by wares.Extension.
+package sessiontest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ursiform/bear"
+	"github.com/ursiform/forest"
+	"github.com/ursiform/forest-wares"
+)
+
+const (
+	root     = "/sessiontest"
+	userID   = "sessiontest-user"
+	userJSON = `{"id":"sessiontest-user"}`
+)
+
+// Config describes the SessionManager under test.
+type Config struct {
+	// Advance moves the clock of the managers returned by New forward, e.g.
+	// the Advance method of a wares.FakeClock passed in their configs. If it
+	// is nil, expiry is verified by sleeping, and the checks that cannot be
+	// timed reliably that way are skipped.
+	Advance func(d time.Duration)
+	// Failing returns a manager whose store operations all fail, e.g. because
+	// its database is unreachable. If it is nil, error propagation is not
+	// verified.
+	Failing func(t *testing.T) wares.SessionManager
+	// New returns a manager that holds no sessions. It is called by each
+	// subtest, and it is required.
+	New func(t *testing.T) wares.SessionManager
+	// User is the user logged in through the session wares; the manager's
+	// Create must be able to decode its JSON encoding. It defaults to an
+	// object with an "id" field.
+	User interface{}
+}
+
+// Run verifies the manager described by config in a series of subtests.
+func Run(t *testing.T, config Config) {
+	if config.New == nil {
+		t.Fatal("sessiontest: Config.New is required")
+	}
+	if config.User == nil {
+		config.User = map[string]string{"id": userID}
+	}
+	s := &suite{config}
+	t.Run("ReadMissing", s.readMissing)
+	t.Run("UpdateRead", s.updateRead)
+	t.Run("Delete", s.delete)
+	t.Run("Revoke", s.revoke)
+	t.Run("Expiry", s.expiry)
+	t.Run("Extensions", s.extensions)
+	t.Run("Wares", s.wares)
+	t.Run("Concurrency", s.concurrency)
+	t.Run("Context", s.context)
+	t.Run("Errors", s.errors)
+}
+
+type suite struct{ Config }
+
+func (s *suite) readMissing(t *testing.T) {
+	manager := s.New(t)
+	userID, userJSON, err := manager.Read("missing")
+	if err != nil {
+		t.Fatalf("Read of a missing session should not fail: %v", err)
+	}
+	if userID != "" || userJSON != "" {
+		t.Errorf("Read of a missing session want: empty got: %q, %q",
+			userID, userJSON)
+	}
+}
+
+func (s *suite) updateRead(t *testing.T) {
+	manager := s.New(t)
+	update(t, manager, "session", userID, userJSON, time.Hour)
+	expect(t, manager, "session", userID, userJSON)
+	// Update replaces a session, including its user.
+	update(t, manager, "session", "other-user", `{"id":"other"}`, time.Hour)
+	expect(t, manager, "session", "other-user", `{"id":"other"}`)
+	// An anonymous session may be stored to hold data, e.g. flash messages.
+	update(t, manager, "anonymous", "", userJSON, time.Hour)
+	expect(t, manager, "anonymous", "", userJSON)
+	// Updating with a duration that is not positive deletes a session.
+	update(t, manager, "session", userID, userJSON, 0)
+	expect(t, manager, "session", "", "")
+}
+
+func (s *suite) delete(t *testing.T) {
+	manager := s.New(t)
+	update(t, manager, "deleted", userID, userJSON, time.Hour)
+	update(t, manager, "kept", userID, userJSON, time.Hour)
+	if err := manager.Delete("deleted", userID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	expect(t, manager, "deleted", "", "")
+	expect(t, manager, "kept", userID, userJSON)
+	if err := manager.Delete("missing", userID); err != nil {
+		t.Errorf("Delete of a missing session should not fail: %v", err)
+	}
+}
+
+func (s *suite) revoke(t *testing.T) {
+	manager := s.New(t)
+	update(t, manager, "first", userID, userJSON, time.Hour)
+	update(t, manager, "second", userID, userJSON, time.Hour)
+	update(t, manager, "other", "other-user", userJSON, time.Hour)
+	if err := manager.Revoke(userID); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	expect(t, manager, "first", "", "")
+	expect(t, manager, "second", "", "")
+	expect(t, manager, "other", "other-user", userJSON)
+	if err := manager.Revoke("missing-user"); err != nil {
+		t.Errorf("Revoke of a user without sessions should not fail: %v", err)
+	}
+}
+
+func (s *suite) expiry(t *testing.T) {
+	manager := s.New(t)
+	duration := time.Minute
+	if s.Advance == nil {
+		duration = 100 * time.Millisecond
+	}
+	update(t, manager, "expiring", userID, userJSON, duration)
+	update(t, manager, "lasting", userID, userJSON, 100*duration)
+	expect(t, manager, "expiring", userID, userJSON)
+	if s.Advance != nil {
+		// Updating a session extends its lifetime.
+		update(t, manager, "refreshed", userID, userJSON, duration)
+		s.Advance(duration * 3 / 4)
+		update(t, manager, "refreshed", userID, userJSON, duration)
+		s.Advance(duration * 3 / 4)
+		expect(t, manager, "refreshed", userID, userJSON)
+		s.Advance(duration * 3 / 4)
+	} else {
+		time.Sleep(duration * 3 / 2)
+	}
+	expect(t, manager, "expiring", "", "")
+	expect(t, manager, "lasting", userID, userJSON)
+	if reader, ok := wares.Extension[wares.SessionInfoReader](manager); ok {
+		if info, err := reader.ReadInfo("expiring"); info != nil || err != nil {
+			t.Errorf("ReadInfo of an expired session want: nil got: %v, %v",
+				info, err)
+		}
+	}
+	if lister, ok := wares.Extension[wares.SessionLister](manager); ok {
+		sessions, err := lister.ListSessions(userID)
+		if err != nil {
+			t.Fatalf("ListSessions failed: %v", err)
+		}
+		for _, info := range sessions {
+			if info.SessionID == "expiring" {
+				t.Errorf("ListSessions should omit expired sessions")
+			}
+		}
+	}
+}
+
+func (s *suite) extensions(t *testing.T) {
+	manager := s.New(t)
+	update(t, manager, "session", userID, userJSON, time.Hour)
+	update(t, manager, "other", userID, userJSON, time.Hour)
+	update(t, manager, "stranger", "other-user", userJSON, time.Hour)
+	if toucher, ok := wares.Extension[wares.SessionToucher](manager); ok {
+		if err := toucher.Touch("session", "192.0.2.1", "agent"); err != nil {
+			t.Errorf("Touch failed: %v", err)
+		}
+		if err := toucher.Touch("missing", "192.0.2.1", "agent"); err != nil {
+			t.Errorf("Touch of a missing session should not fail: %v", err)
+		}
+	}
+	fingerprinter, ok := wares.Extension[wares.SessionFingerprinter](manager)
+	if ok {
+		for _, fingerprint := range []string{"first", "second"} {
+			err := fingerprinter.SetFingerprint("session", fingerprint)
+			if err != nil {
+				t.Errorf("SetFingerprint failed: %v", err)
+			}
+		}
+	}
+	reader, ok := wares.Extension[wares.SessionInfoReader](manager)
+	if !ok {
+		t.Skip("the manager does not support SessionInfoReader")
+	}
+	first := readInfo(t, reader, "session")
+	if first.SessionID != "session" || first.UserID != userID ||
+		first.UserJSON != userJSON {
+		t.Errorf("ReadInfo want: session, %s, %s got: %s, %s, %s",
+			userID, userJSON, first.SessionID, first.UserID, first.UserJSON)
+	}
+	if first.Created.IsZero() || !first.Expires.After(first.Created) {
+		t.Errorf("ReadInfo should report when a session was created and "+
+			"when it expires, got: %v, %v", first.Created, first.Expires)
+	}
+	if _, ok := wares.Extension[wares.SessionToucher](manager); ok {
+		if first.IP != "192.0.2.1" || first.UserAgent != "agent" ||
+			first.LastSeen.IsZero() {
+			t.Errorf("ReadInfo should report what Touch recorded, got: "+
+				"%q, %q, %v", first.IP, first.UserAgent, first.LastSeen)
+		}
+	}
+	if _, ok := wares.Extension[wares.SessionFingerprinter](manager); ok &&
+		first.Fingerprint != "first" {
+		t.Errorf("a bound session should keep its fingerprint, got: %q",
+			first.Fingerprint)
+	}
+	// Update keeps what describes a session rather than its user.
+	update(t, manager, "session", userID, `{"id":"updated"}`, time.Hour)
+	second := readInfo(t, reader, "session")
+	if !second.Created.Equal(first.Created) || second.IP != first.IP ||
+		second.UserAgent != first.UserAgent ||
+		second.Fingerprint != first.Fingerprint {
+		t.Errorf("Update should keep a session's metadata, got: %+v", second)
+	}
+	lister, ok := wares.Extension[wares.SessionLister](manager)
+	if !ok {
+		return
+	}
+	sessions, err := lister.ListSessions(userID)
+	if err != nil {
+		t.Fatalf("ListSessions failed: %v", err)
+	}
+	listed := make(map[string]bool)
+	for _, info := range sessions {
+		listed[info.SessionID] = info.UserID == userID
+	}
+	if len(listed) != 2 || !listed["session"] || !listed["other"] {
+		t.Errorf("ListSessions want: session, other got: %v", listed)
+	}
+}
+
+func (s *suite) wares(t *testing.T) {
+	manager := s.New(t)
+	app := s.newApp(manager)
+	// A request without a session gets a new, empty one.
+	response, anonymous := request(t, app, "", "/user")
+	if anonymous.SessionID == "" || anonymous.UserID != "" {
+		t.Errorf("CreateEmpty want: a session ID got: %+v", anonymous)
+	}
+	if response.Code != http.StatusOK {
+		t.Errorf("/user want: %d got: %d", http.StatusOK, response.Code)
+	}
+	// SessionSet stores the user that Create restores.
+	response, _ = request(t, app, "", "/login")
+	auth := cookie(response)
+	if auth == "" {
+		t.Fatalf("/login should set a session cookie, got: %d", response.Code)
+	}
+	if stored, userJSON, err := manager.Read(auth); stored != userID ||
+		userJSON == "" || err != nil {
+		t.Errorf("SessionSet should store the user, got: %q, %q, %v",
+			stored, userJSON, err)
+	}
+	if _, resumed := request(t, app, auth, "/user"); resumed.SessionID !=
+		auth || resumed.UserID != userID || !resumed.User {
+		t.Errorf("Create want: %s, %s and a user got: %+v",
+			auth, userID, resumed)
+	}
+	// Create fails for a user it cannot decode, so the session is ignored.
+	update(t, manager, auth, userID, "{not JSON", time.Hour)
+	if _, resumed := request(t, app, auth, "/user"); resumed.UserID != "" {
+		t.Errorf("Create should fail for invalid userJSON, got: %+v", resumed)
+	}
+}
+
+func (s *suite) concurrency(t *testing.T) {
+	manager := s.New(t)
+	var group sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		group.Add(1)
+		go func(i int) {
+			defer group.Done()
+			user := fmt.Sprintf("user-%d", i%2)
+			for j := 0; j < 25; j++ {
+				sessionID := fmt.Sprintf("session-%d", (i+j)%6)
+				err := manager.Update(sessionID, user, userJSON, time.Hour)
+				if err != nil {
+					t.Errorf("Update failed: %v", err)
+				}
+				if _, _, err := manager.Read(sessionID); err != nil {
+					t.Errorf("Read failed: %v", err)
+				}
+				if j%5 == 0 {
+					if err := manager.Delete(sessionID, user); err != nil {
+						t.Errorf("Delete failed: %v", err)
+					}
+				}
+				if j%7 == 0 {
+					if err := manager.Revoke(user); err != nil {
+						t.Errorf("Revoke failed: %v", err)
+					}
+				}
+			}
+		}(i)
+	}
+	group.Wait()
+	update(t, manager, "session-0", userID, userJSON, time.Hour)
+	expect(t, manager, "session-0", userID, userJSON)
+}
+
+func (s *suite) context(t *testing.T) {
+	manager := s.New(t)
+	store := wares.NewContextSessionManager(manager)
+	update(t, manager, "session", userID, userJSON, time.Hour)
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := store.ReadContext(c, "session"); err == nil {
+		t.Errorf("ReadContext should fail once its context is done")
+	}
+	if err := store.UpdateContext(c, "cancelled", userID, userJSON,
+		time.Hour); err == nil {
+		t.Errorf("UpdateContext should fail once its context is done")
+	}
+	if err := store.DeleteContext(c, "session", userID); err == nil {
+		t.Errorf("DeleteContext should fail once its context is done")
+	}
+	if err := store.RevokeContext(c, userID); err == nil {
+		t.Errorf("RevokeContext should fail once its context is done")
+	}
+	expect(t, manager, "cancelled", "", "")
+	expect(t, manager, "session", userID, userJSON)
+}
+
+func (s *suite) errors(t *testing.T) {
+	if s.Failing == nil {
+		t.Skip("Config.Failing is nil")
+	}
+	manager := s.Failing(t)
+	if err := manager.Update("session", userID, userJSON,
+		time.Hour); err == nil {
+		t.Errorf("Update should fail")
+	}
+	if _, _, err := manager.Read("session"); err == nil {
+		t.Errorf("Read should fail")
+	}
+	if err := manager.Delete("session", userID); err == nil {
+		t.Errorf("Delete should fail")
+	}
+	if err := manager.Revoke(userID); err == nil {
+		t.Errorf("Revoke should fail")
+	}
+	// The session wares treat a session that cannot be read as missing, and
+	// fail a request whose session cannot be stored.
+	app := s.newApp(manager)
+	response, anonymous := request(t, app, "session", "/user")
+	if response.Code != http.StatusOK || anonymous.UserID != "" {
+		t.Errorf("/user want: %d and no user got: %d, %+v",
+			http.StatusOK, response.Code, anonymous)
+	}
+	if response, _ = request(t, app, "", "/login"); response.Code !=
+		http.StatusInternalServerError {
+		t.Errorf("/login want: %d got: %d",
+			http.StatusInternalServerError, response.Code)
+	}
+}
+
+func (s *suite) newApp(manager wares.SessionManager) *forest.App {
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager)
+	app.RegisterRoute(root, &router{App: app, user: s.User})
+	return app
+}
+
+type router struct {
+	*forest.App
+	user interface{}
+}
+
+// session is the state a request was given by the session wares.
+type session struct {
+	SessionID string `json:"sessionid"`
+	User      bool   `json:"user"`
+	UserID    string `json:"userid"`
+}
+
+func (app *router) login(ctx *bear.Context) {
+	ctx.Set(forest.SessionUserID, userID)
+	ctx.Set(forest.SessionUser, app.user)
+	ctx.Next()
+}
+func (app *router) respond(ctx *bear.Context) {
+	sessionID, _ := ctx.Get(forest.SessionID).(string)
+	userID, _ := ctx.Get(forest.SessionUserID).(string)
+	app.Response(ctx, http.StatusOK, forest.Success, forest.NoMessage).
+		Write(&session{
+			SessionID: sessionID,
+			User:      ctx.Get(forest.SessionUser) != nil,
+			UserID:    userID})
+}
+
+func (app *router) Route(path string) {
+	app.On("GET", path+"/login",
+		app.Ware("SessionGet"),
+		app.login,
+		app.Ware("SessionSet"),
+		app.respond)
+	app.On("GET", path+"/user",
+		app.Ware("SessionGet"),
+		app.respond)
+}
+
+// cookie returns the last session cookie set by response.
+func cookie(response *httptest.ResponseRecorder) string {
+	value := ""
+	for _, cookie := range (&http.Response{
+		Header: response.Header()}).Cookies() {
+		if cookie.Name == forest.SessionID {
+			value = cookie.Value
+		}
+	}
+	return value
+}
+
+func expect(t *testing.T, manager wares.SessionManager, sessionID string,
+	wantUserID string, wantUserJSON string) {
+	t.Helper()
+	userID, userJSON, err := manager.Read(sessionID)
+	if err != nil {
+		t.Fatalf("Read(%s) failed: %v", sessionID, err)
+	}
+	if userID != wantUserID || userJSON != wantUserJSON {
+		t.Errorf("Read(%s) want: %q, %q got: %q, %q",
+			sessionID, wantUserID, wantUserJSON, userID, userJSON)
+	}
+}
+
+func readInfo(t *testing.T, reader wares.SessionInfoReader,
+	sessionID string) *wares.SessionInfo {
+	t.Helper()
+	info, err := reader.ReadInfo(sessionID)
+	if err != nil || info == nil {
+		t.Fatalf("ReadInfo(%s) want: a session got: %v, %v",
+			sessionID, info, err)
+	}
+	return info
+}
+
+// request makes a request with auth as its session cookie and returns the
+// session the wares gave it.
+func request(t *testing.T, app *forest.App, auth string,
+	path string) (*httptest.ResponseRecorder, *session) {
+	t.Helper()
+	request := httptest.NewRequest("GET", root+path, nil)
+	if auth != "" {
+		request.AddCookie(&http.Cookie{Name: forest.SessionID, Value: auth})
+	}
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, request)
+	result := new(struct{ Data *session })
+	if response.Code == http.StatusOK {
+		if err := json.Unmarshal(response.Body.Bytes(), result); err != nil ||
+			result.Data == nil {
+			t.Fatalf("%s responded with: %s", path, response.Body.String())
+		}
+	}
+	if result.Data == nil {
+		result.Data = new(session)
+	}
+	return response, result.Data
+}
+
+func update(t *testing.T, manager wares.SessionManager, sessionID string,
+	userID string, userJSON string, duration time.Duration) {
+	t.Helper()
+	if err := manager.Update(sessionID, userID, userJSON,
+		duration); err != nil {
+		t.Fatalf("Update(%s) failed: %v", sessionID, err)
+	}
+}
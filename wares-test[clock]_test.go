@@ -0,0 +1,166 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ursiform/forest"
+	"github.com/ursiform/forest-wares"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock := wares.NewFakeClock(start)
+	if !clock.Now().Equal(start) {
+		t.Errorf("Now want: %v got: %v", start, clock.Now())
+	}
+	clock.Advance(time.Hour)
+	if want := start.Add(time.Hour); !clock.Now().Equal(want) {
+		t.Errorf("Advance want: %v got: %v", want, clock.Now())
+	}
+	clock.Set(start)
+	if !clock.Now().Equal(start) {
+		t.Errorf("Set want: %v got: %v", start, clock.Now())
+	}
+}
+
+func TestClockAbsoluteTimeout(t *testing.T) {
+	clock := wares.NewFakeClock(time.Now())
+	manager := wares.NewMemorySessionManager(&wares.MemoryConfig{
+		Clock:   clock,
+		NewUser: func() interface{} { return new(memoryUser) }})
+	defer manager.Close()
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager, wares.WithClock(clock),
+		wares.WithIdleTimeout(time.Hour),
+		wares.WithAbsoluteTimeout(90*time.Minute))
+	app.RegisterRoute(root, &memoryRouter{app})
+	auth := login(t, app)
+	params := &requested{auth: auth, method: "GET", path: root + "/user"}
+	want := &wanted{code: http.StatusOK, success: true}
+	clock.Advance(50 * time.Minute)
+	makeRequest(t, app, params, want)
+	clock.Advance(50 * time.Minute)
+	want = &wanted{code: http.StatusUnauthorized, success: false}
+	makeRequest(t, app, params, want)
+	if userID, _, _ := manager.Read(auth); userID != "" {
+		t.Errorf("session past its absolute timeout should be deleted")
+	}
+}
+
+func TestClockAbsoluteTimeoutRenewal(t *testing.T) {
+	clock := wares.NewFakeClock(time.Now())
+	memory := wares.NewMemorySessionManager(&wares.MemoryConfig{
+		Clock:   clock,
+		NewUser: func() interface{} { return new(memoryUser) }})
+	defer memory.Close()
+	unlisted := unlistedManager{memory, memory, memory, memory}
+	for _, manager := range []wares.SessionManager{memory, unlisted} {
+		for _, path := range []string{"/login/regenerate", "/revoke/others"} {
+			app := forest.New("")
+			wares.InstallSessionWares(app, manager, wares.WithClock(clock),
+				wares.WithIdleTimeout(time.Hour),
+				wares.WithAbsoluteTimeout(90*time.Minute))
+			app.RegisterRoute(root, &memoryRouter{app})
+			auth := login(t, app)
+			clock.Advance(50 * time.Minute)
+			// Neither regenerating a session nor keeping it while revoking
+			// the others renews it.
+			params := &requested{auth: auth, method: "GET", path: root + path}
+			want := &wanted{code: http.StatusOK, success: true}
+			response, _ := makeRequest(t, app, params, want)
+			if regenerated := sessionCookie(response); regenerated != "" {
+				auth = regenerated
+			}
+			params = &requested{auth: auth, method: "GET", path: root + "/user"}
+			makeRequest(t, app, params, want)
+			clock.Advance(50 * time.Minute)
+			want = &wanted{code: http.StatusUnauthorized, success: false}
+			makeRequest(t, app, params, want)
+		}
+	}
+}
+
+func TestClockTouch(t *testing.T) {
+	clock := wares.NewFakeClock(time.Now())
+	manager := wares.NewMemorySessionManager(&wares.MemoryConfig{
+		Clock:   clock,
+		NewUser: func() interface{} { return new(memoryUser) }})
+	defer manager.Close()
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager, wares.WithClock(clock),
+		wares.WithIdleTimeout(time.Hour), wares.WithRefreshThreshold(0.5))
+	app.RegisterRoute(root, &memoryRouter{app})
+	_, auth := agentRequest(app, "", "laptop", "/login")
+	lastSeen := func() time.Time {
+		info, err := manager.ReadInfo(auth)
+		if err != nil || info == nil {
+			t.Fatalf("ReadInfo want: session got: %v, %v", info, err)
+		}
+		return info.LastSeen
+	}
+	// A session that is read but not refreshed is still touched...
+	clock.Advance(2 * time.Minute)
+	agentRequest(app, auth, "laptop", "/user")
+	if seen := lastSeen(); !seen.Equal(clock.Now()) {
+		t.Errorf("LastSeen want: %v got: %v", clock.Now(), seen)
+	}
+	// ...but at most once a minute...
+	touched := clock.Now()
+	clock.Advance(30 * time.Second)
+	agentRequest(app, auth, "laptop", "/user")
+	if seen := lastSeen(); !seen.Equal(touched) {
+		t.Errorf("LastSeen want: %v got: %v", touched, seen)
+	}
+	// ...unless its client changes.
+	agentRequest(app, auth, "phone", "/user")
+	if seen := lastSeen(); !seen.Equal(clock.Now()) {
+		t.Errorf("LastSeen want: %v got: %v", clock.Now(), seen)
+	}
+}
+
+func TestClockCookieExpiry(t *testing.T) {
+	clock := wares.NewFakeClock(time.Now())
+	manager, err := wares.NewSignedCookieSessionManager(&wares.CookieConfig{
+		Clock:   clock,
+		Keys:    wares.Keyring{Current: cookieKeyCurrent},
+		NewUser: func() interface{} { return new(memoryUser) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := forest.New("")
+	wares.InstallCookieSessionWares(app, manager, wares.WithClock(clock),
+		wares.WithIdleTimeout(10*time.Minute),
+		wares.WithAbsoluteTimeout(25*time.Minute))
+	app.RegisterRoute(root, &memoryRouter{app})
+	auth := login(t, app)
+	// The idle timeout, not app.Duration("Session"), dates the cookie.
+	params := &requested{auth: auth, method: "GET", path: root + "/user"}
+	want := &wanted{code: http.StatusOK, success: true}
+	clock.Advance(9 * time.Minute)
+	response, _ := makeRequest(t, app, params, want)
+	refreshed := sessionCookie(response)
+	clock.Advance(2 * time.Minute)
+	want = &wanted{code: http.StatusUnauthorized, success: false}
+	makeRequest(t, app, params, want)
+	// Neither refreshing a cookie nor logging in with it again renews it.
+	params = &requested{auth: refreshed, method: "GET", path: root + "/login"}
+	want = &wanted{code: http.StatusOK, success: true}
+	response, _ = makeRequest(t, app, params, want)
+	auth = sessionCookie(response)
+	for i := 0; i < 2; i++ {
+		clock.Advance(6 * time.Minute)
+		params = &requested{auth: auth, method: "GET", path: root + "/user"}
+		response, _ = makeRequest(t, app, params, want)
+		auth = sessionCookie(response)
+	}
+	clock.Advance(3 * time.Minute)
+	params = &requested{auth: auth, method: "GET", path: root + "/user"}
+	want = &wanted{code: http.StatusUnauthorized, success: false}
+	makeRequest(t, app, params, want)
+}
@@ -0,0 +1,163 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares_test
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ursiform/forest"
+	"github.com/ursiform/forest-wares"
+)
+
+type logEntry struct {
+	level  string
+	msg    string
+	fields map[string]interface{}
+}
+
+// implements Logger
+type recordingLogger struct {
+	sync.Mutex
+	entries []logEntry
+}
+
+func (logger *recordingLogger) record(level string, msg string,
+	args []interface{}) {
+	logger.Lock()
+	defer logger.Unlock()
+	fields := make(map[string]interface{})
+	for i := 0; i+1 < len(args); i += 2 {
+		fields[args[i].(string)] = args[i+1]
+	}
+	logger.entries = append(logger.entries, logEntry{level, msg, fields})
+}
+func (logger *recordingLogger) Debug(msg string, args ...interface{}) {
+	logger.record("debug", msg, args)
+}
+func (logger *recordingLogger) Error(msg string, args ...interface{}) {
+	logger.record("error", msg, args)
+}
+func (logger *recordingLogger) Info(msg string, args ...interface{}) {
+	logger.record("info", msg, args)
+}
+func (logger *recordingLogger) Warn(msg string, args ...interface{}) {
+	logger.record("warn", msg, args)
+}
+
+func newLoggerApp(logger wares.Logger) *forest.App {
+	app := forest.New("")
+	opts := []wares.Option{wares.WithLogger(logger)}
+	wares.InstallBodyParser(app, opts...)
+	wares.InstallErrorWares(app, opts...)
+	wares.InstallSecurityWares(app, opts...)
+	wares.InstallSessionWares(app, new(sessionManager), opts...)
+	app.RegisterRoute(root, &router{app})
+	return app
+}
+
+func TestLoggerErrorWares(t *testing.T) {
+	tests := []struct {
+		path  string
+		code  int
+		level string
+	}{
+		{root + "/bad-request", http.StatusBadRequest, "warn"},
+		{root + "/server-error", http.StatusInternalServerError, "error"}}
+	for _, test := range tests {
+		logger := new(recordingLogger)
+		app := newLoggerApp(logger)
+		params := &requested{method: "GET", path: test.path}
+		want := &wanted{code: test.code, success: false}
+		makeRequest(t, app, params, want)
+		if len(logger.entries) != 1 {
+			t.Errorf("%s want: 1 log entry got: %d",
+				test.path, len(logger.entries))
+			continue
+		}
+		entry := logger.entries[0]
+		if entry.level != test.level {
+			t.Errorf("%s want: %s got: %s", test.path, test.level, entry.level)
+		}
+		if entry.fields["status"] != test.code {
+			t.Errorf("%s status want: %d got: %v",
+				test.path, test.code, entry.fields["status"])
+		}
+		if entry.fields["route"] != test.path {
+			t.Errorf("%s route want: %s got: %v",
+				test.path, test.path, entry.fields["route"])
+		}
+	}
+}
+
+func TestLoggerSessionGet(t *testing.T) {
+	logger := new(recordingLogger)
+	app := newLoggerApp(logger)
+	params := &requested{auth: sessionIDWithUpdateError,
+		method: "GET", path: root + "/session-get"}
+	want := &wanted{code: http.StatusOK, success: true}
+	makeRequest(t, app, params, want)
+	if len(logger.entries) != 1 {
+		t.Fatalf("want: 1 log entry got: %d", len(logger.entries))
+	}
+	entry := logger.entries[0]
+	if entry.level != "error" || entry.fields["error"] == nil {
+		t.Errorf("a store failure should be logged as an error: %v", entry)
+	}
+	session, _ := entry.fields["session"].(string)
+	if session == "" || strings.Contains(session, sessionIDWithUpdateError) {
+		t.Errorf("session should be logged as a hash, got: %q", session)
+	}
+}
+
+func TestLoggerSessionWares(t *testing.T) {
+	tests := []struct {
+		auth string
+		path string
+	}{
+		{sessionIDWithDeleteError, root + "/session-del"},
+		{sessionIDWithUpdateError, root + "/session-set"}}
+	for _, test := range tests {
+		logger := new(recordingLogger)
+		app := newLoggerApp(logger)
+		params := &requested{auth: test.auth, method: "GET", path: test.path}
+		want := &wanted{code: http.StatusInternalServerError, success: false}
+		makeRequest(t, app, params, want)
+		logged := false
+		for _, entry := range logger.entries {
+			logged = logged || (entry.msg == "error response" &&
+				entry.level == "error" &&
+				entry.fields["status"] == http.StatusInternalServerError)
+		}
+		if !logged {
+			t.Errorf("%s should log its error response: %v",
+				test.path, logger.entries)
+		}
+	}
+}
+
+func TestLoggerDefault(t *testing.T) {
+	var output bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&output, nil)))
+	defer slog.SetDefault(previous)
+	app := forest.New("")
+	wares.InstallSessionWares(app, new(sessionManager))
+	app.RegisterRoute(root, &router{app})
+	params := &requested{auth: sessionIDWithUpdateError,
+		method: "GET", path: root + "/session-get"}
+	want := &wanted{code: http.StatusOK, success: true}
+	makeRequest(t, app, params, want)
+	logged := output.String()
+	if !strings.Contains(logged, "level=ERROR") ||
+		!strings.Contains(logged, "error updating session") {
+		t.Errorf("the default Logger should log to slog.Default(), got: %q",
+			logged)
+	}
+}
@@ -118,6 +118,20 @@ func (app *router) Route(path string) {
 		app.Ware("SessionGet"),
 		app.sessionVerify,
 		app.respondSuccess)
+	app.On("GET", path+"/session-regenerate",
+		app.Ware("SessionGet"),
+		app.Ware("SessionRegenerate"),
+		app.respondSuccess)
+	app.On("GET", path+"/session-revoke",
+		app.Ware("SessionGet"),
+		app.sessionDelIntercept,
+		app.Ware("SessionRevoke"),
+		app.respondSuccess)
+	app.On("GET", path+"/session-revoke/others",
+		app.Ware("SessionGet"),
+		app.sessionDelIntercept,
+		app.Ware("SessionRevokeOthers"),
+		app.respondSuccess)
 	app.On("GET", path+"/session-set",
 		app.Ware("SessionGet"),
 		app.Ware("SessionSet"),
@@ -0,0 +1,187 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ursiform/bear"
+	"github.com/ursiform/forest"
+	"github.com/ursiform/forest-wares"
+)
+
+func TestFingerprints(t *testing.T) {
+	prefix := wares.IPPrefixFingerprint(nil, 24, 48)
+	tests := []struct {
+		address string
+		want    string
+	}{
+		{"192.0.2.77:1234", "192.0.2.0"},
+		{"[2001:db8:1:2::7]:1234", "2001:db8:1::"},
+		{"invalid", ""}}
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.RemoteAddr = test.address
+		if fingerprint := prefix(request); fingerprint != test.want {
+			t.Errorf("IPPrefixFingerprint(%s) want: %q got: %q",
+				test.address, test.want, fingerprint)
+		}
+	}
+	request := httptest.NewRequest("GET", "/", nil)
+	certificate := wares.TLSCertFingerprint()
+	if fingerprint := certificate(request); fingerprint != "" {
+		t.Errorf("TLSCertFingerprint without a certificate should be empty")
+	}
+	request.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+		{Raw: []byte("certificate")}}}
+	if fingerprint := certificate(request); fingerprint == "" {
+		t.Errorf("TLSCertFingerprint should hash the client certificate")
+	}
+	userAgent := wares.UserAgentFingerprint()
+	request.Header.Set("User-Agent", "first")
+	first := userAgent(request)
+	request.Header.Set("User-Agent", "second")
+	if first == userAgent(request) {
+		t.Errorf("UserAgentFingerprint should differ between user agents")
+	}
+}
+
+func TestSessionBinding(t *testing.T) {
+	for _, mode := range []wares.BindingMode{
+		wares.BindingStrict, wares.BindingLenient} {
+		manager := newMemoryManager()
+		defer manager.Close()
+		mismatches := 0
+		app := forest.New("")
+		wares.InstallSessionWares(app, manager, wares.WithBinding(
+			wares.UserAgentFingerprint(), mode,
+			func(ctx *bear.Context, info *wares.SessionInfo,
+				fingerprint string) {
+				mismatches++
+			}))
+		app.RegisterRoute(root, &memoryRouter{app})
+		request := httptest.NewRequest("GET", root+"/login", nil)
+		request.Header.Set("User-Agent", "owner")
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		auth := sessionCookie(&http.Response{Header: response.Header()})
+		codes := map[string]int{"owner": http.StatusOK, "thief": http.StatusOK}
+		if mode == wares.BindingStrict {
+			codes["thief"] = http.StatusUnauthorized
+		}
+		for _, agent := range []string{"owner", "thief"} {
+			request := httptest.NewRequest("GET", root+"/user", nil)
+			request.Header.Set("User-Agent", agent)
+			request.AddCookie(&http.Cookie{Name: forest.SessionID, Value: auth})
+			response := httptest.NewRecorder()
+			app.ServeHTTP(response, request)
+			if response.Code != codes[agent] {
+				t.Errorf("%s want: %d got: %d",
+					agent, codes[agent], response.Code)
+			}
+		}
+		if mismatches != 1 {
+			t.Errorf("onMismatch want: 1 call got: %d", mismatches)
+		}
+		if userID, _, _ := manager.Read(auth); userID != sessionUserID {
+			t.Errorf("a mismatch should not delete the bound session")
+		}
+	}
+}
+
+// agentRequest requests path with auth on behalf of a user agent and returns
+// the response code along with the session cookie it sets, if any.
+func agentRequest(app *forest.App, auth string, agent string,
+	path string) (int, string) {
+	request := httptest.NewRequest("GET", root+path, nil)
+	request.Header.Set("User-Agent", agent)
+	if auth != "" {
+		request.AddCookie(&http.Cookie{Name: forest.SessionID, Value: auth})
+	}
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, request)
+	return response.Code,
+		sessionCookie(&http.Response{Header: response.Header()})
+}
+
+func TestSessionBindingRevokeOthers(t *testing.T) {
+	memory := newMemoryManager()
+	defer memory.Close()
+	unlisted := unlistedManager{memory, memory, memory, memory}
+	for _, manager := range []wares.SessionManager{memory, unlisted} {
+		app := forest.New("")
+		wares.InstallSessionWares(app, manager, wares.WithBinding(
+			wares.UserAgentFingerprint(), wares.BindingStrict, nil))
+		app.RegisterRoute(root, &memoryRouter{app})
+		_, auth := agentRequest(app, "", "owner", "/login")
+		_, other := agentRequest(app, "", "owner", "/login")
+		tests := []struct {
+			auth  string
+			agent string
+			want  int
+		}{
+			{auth, "owner", http.StatusOK},
+			{auth, "thief", http.StatusUnauthorized},
+			{other, "owner", http.StatusUnauthorized}}
+		code, _ := agentRequest(app, auth, "owner", "/revoke/others")
+		if code != http.StatusOK {
+			t.Fatalf("/revoke/others want: 200 got: %d", code)
+		}
+		for i, test := range tests {
+			code, _ := agentRequest(app, test.auth, test.agent, "/user")
+			if code != test.want {
+				t.Errorf("%T: request %d want: %d got: %d",
+					manager, i, test.want, code)
+			}
+		}
+	}
+}
+
+func TestSessionBindingUnbound(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager, wares.WithBinding(
+		wares.UserAgentFingerprint(), wares.BindingStrict, nil))
+	app.RegisterRoute(root, &memoryRouter{app})
+	// A session stored without a fingerprint, e.g. before binding was
+	// enabled, does not match any client's fingerprint.
+	manager.Update(sessionIDExistent, sessionUserID, sessionUserJSON, time.Hour)
+	request := httptest.NewRequest("GET", root+"/user", nil)
+	request.Header.Set("User-Agent", "thief")
+	request.AddCookie(&http.Cookie{
+		Name: forest.SessionID, Value: sessionIDExistent})
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, request)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("an unbound session want: %d got: %d",
+			http.StatusUnauthorized, response.Code)
+	}
+}
+
+func TestSessionBindingUnreadable(t *testing.T) {
+	memory := newMemoryManager()
+	defer memory.Close()
+	unreadable := unreadableManager{memory, memory}
+	// Whether or not it is wrapped, a manager that cannot read fingerprints
+	// back cannot bind sessions, so binding is not enforced.
+	for _, manager := range []wares.SessionManager{unreadable,
+		wares.NewCachedSessionManager(unreadable, nil)} {
+		app := forest.New("")
+		wares.InstallSessionWares(app, manager, wares.WithBinding(
+			wares.UserAgentFingerprint(), wares.BindingStrict, nil))
+		app.RegisterRoute(root, &memoryRouter{app})
+		_, auth := agentRequest(app, "", "owner", "/login")
+		if code, _ := agentRequest(app, auth, "owner", "/user"); code !=
+			http.StatusOK {
+			t.Errorf("%T want: %d got: %d", manager, http.StatusOK, code)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares_test
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ursiform/forest"
+	"github.com/ursiform/forest-wares"
+)
+
+func TestCachedSessionManager(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	cache := wares.NewCachedSessionManager(manager, nil)
+	cache.Update("A", sessionUserID, sessionUserJSON, time.Hour)
+	cache.Update("B", sessionUserID, sessionUserJSON, time.Hour)
+	for i := 0; i < 2; i++ {
+		if userID, _, _ := cache.Read("A"); userID != sessionUserID {
+			t.Errorf("Read want: %s got: %s", sessionUserID, userID)
+		}
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Stats want: 1 hit 1 miss got: %+v", stats)
+	}
+	// Update invalidates the cached session.
+	cache.Update("A", sessionUserID, `{"id":"updated"}`, time.Hour)
+	if _, userJSON, _ := cache.Read("A"); userJSON != `{"id":"updated"}` {
+		t.Errorf("Read after Update got stale userJSON: %s", userJSON)
+	}
+	// Delete invalidates the cached session.
+	cache.Delete("A", sessionUserID)
+	if userID, _, _ := cache.Read("A"); userID != "" {
+		t.Errorf("Read after Delete want: empty got: %s", userID)
+	}
+	// Revoke invalidates every cached session of the user.
+	cache.Read("B")
+	manager.Update("C", sessionUserID, sessionUserJSON, time.Hour)
+	cache.Revoke(sessionUserID)
+	for _, sessionID := range []string{"B", "C"} {
+		if info, _ := cache.ReadInfo(sessionID); info != nil {
+			t.Errorf("ReadInfo(%s) after Revoke want: nil", sessionID)
+		}
+	}
+	// ReadInfo returns a copy that callers may modify.
+	cache.Update("D", sessionUserID, sessionUserJSON, time.Hour)
+	cache.ReadInfo("D")
+	info, _ := cache.ReadInfo("D")
+	info.UserID = "modified"
+	if info, _ = cache.ReadInfo("D"); info.UserID != sessionUserID {
+		t.Errorf("modifying ReadInfo's result should not modify the cache")
+	}
+}
+
+func TestCachedSessionManagerEviction(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	cache := wares.NewCachedSessionManager(manager,
+		&wares.CacheConfig{Size: 2, TTL: 20 * time.Millisecond})
+	for _, sessionID := range []string{"A", "B", "C"} {
+		manager.Update(sessionID, sessionUserID, sessionUserJSON, time.Hour)
+	}
+	// A is read most recently, so B is evicted when C is cached.
+	for _, sessionID := range []string{"A", "B", "A", "C", "A", "B"} {
+		cache.Read(sessionID)
+	}
+	if stats := cache.Stats(); stats.Hits != 2 || stats.Misses != 4 {
+		t.Errorf("Stats want: 2 hits 4 misses got: %+v", stats)
+	}
+	// A session changed elsewhere is seen once its TTL has elapsed.
+	manager.Update("A", sessionUserID, `{"id":"updated"}`, time.Hour)
+	if _, userJSON, _ := cache.Read("A"); userJSON != sessionUserJSON {
+		t.Errorf("Read within the TTL should be served from the cache")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, userJSON, _ := cache.Read("A"); userJSON != `{"id":"updated"}` {
+		t.Errorf("Read after the TTL got stale userJSON: %s", userJSON)
+	}
+	// A session does not outlive its own expiry in the cache.
+	manager.Update("E", sessionUserID, sessionUserJSON, 5*time.Millisecond)
+	cache.Read("E")
+	time.Sleep(10 * time.Millisecond)
+	if userID, _, _ := cache.Read("E"); userID != "" {
+		t.Errorf("Read of an expired session want: empty got: %s", userID)
+	}
+}
+
+func TestCachedSessionManagerConcurrency(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	cache := wares.NewCachedSessionManager(manager,
+		&wares.CacheConfig{Size: 4})
+	var group sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		group.Add(1)
+		go func(i int) {
+			defer group.Done()
+			sessionID := fmt.Sprintf("session-%d", i%6)
+			for j := 0; j < 50; j++ {
+				userJSON := fmt.Sprintf(`{"id":"%d"}`, j)
+				cache.Update(sessionID, sessionUserID, userJSON, time.Hour)
+				cache.Read(sessionID)
+				cache.ReadInfo(fmt.Sprintf("session-%d", j%6))
+			}
+		}(i)
+	}
+	group.Wait()
+	// Once writes have stopped, every read agrees with the wrapped manager.
+	for i := 0; i < 6; i++ {
+		sessionID := fmt.Sprintf("session-%d", i)
+		_, want, _ := manager.Read(sessionID)
+		if _, got, _ := cache.Read(sessionID); got != want {
+			t.Errorf("%s want: %s got: %s", sessionID, want, got)
+		}
+	}
+}
+
+func TestCachedSessionManagerWares(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	cache := wares.NewCachedSessionManager(manager, nil)
+	app := forest.New("")
+	// Refreshing a session updates it, so without a threshold every request
+	// would invalidate the cache.
+	wares.InstallSessionWares(app, cache, wares.WithRefreshThreshold(0.5))
+	app.RegisterRoute(root, &memoryRouter{app})
+	auth := login(t, app)
+	params := &requested{auth: auth, method: "GET", path: root + "/user"}
+	want := &wanted{code: http.StatusOK, success: true}
+	for i := 0; i < 3; i++ {
+		makeRequest(t, app, params, want)
+	}
+	if stats := cache.Stats(); stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("Stats want: 2 hits 1 miss got: %+v", stats)
+	}
+	params = &requested{auth: auth, method: "GET", path: root + "/sessions"}
+	makeRequest(t, app, params, want)
+	params = &requested{auth: auth, method: "GET", path: root + "/logout"}
+	makeRequest(t, app, params, want)
+	params = &requested{auth: auth, method: "GET", path: root + "/user"}
+	want = &wanted{code: http.StatusUnauthorized, success: false}
+	makeRequest(t, app, params, want)
+}
+
+func TestCachedSessionManagerPassThrough(t *testing.T) {
+	// sessionManager implements none of the optional extensions.
+	cache := wares.NewCachedSessionManager(new(sessionManager), nil)
+	if _, err := cache.ListSessions(sessionUserID); err == nil {
+		t.Errorf("ListSessions should fail without a SessionLister")
+	}
+	if err := cache.SetFingerprint(sessionIDExistent, "print"); err == nil {
+		t.Errorf("SetFingerprint should fail without a SessionFingerprinter")
+	}
+	if err := cache.Touch(sessionIDExistent, "", ""); err == nil {
+		t.Errorf("Touch should fail without a SessionToucher")
+	}
+	for i := 0; i < 2; i++ {
+		if userID, _, _ := cache.Read(sessionIDExistent); userID != sessionUserID {
+			t.Errorf("Read want: %s got: %s", sessionUserID, userID)
+		}
+	}
+	if info, _ := cache.ReadInfo(sessionIDNonExistent); info != nil {
+		t.Errorf("ReadInfo of a nonexistent session want: nil")
+	}
+	// Without SessionInfoReader, a session's expiry is unknown, so it is
+	// never cached.
+	if stats := cache.Stats(); stats.Hits != 0 || stats.Misses != 3 {
+		t.Errorf("Stats want: 0 hits 3 misses got: %+v", stats)
+	}
+}
+
+func TestCachedSessionManagerUnknownExpiry(t *testing.T) {
+	clock := wares.NewFakeClock(time.Now())
+	manager := wares.NewMemorySessionManager(&wares.MemoryConfig{
+		Clock:   clock,
+		NewUser: func() interface{} { return new(memoryUser) }})
+	defer manager.Close()
+	cache := wares.NewCachedSessionManager(plainManager{manager},
+		&wares.CacheConfig{Clock: clock, TTL: time.Hour})
+	cache.Update("A", sessionUserID, sessionUserJSON, time.Minute)
+	if userID, _, _ := cache.Read("A"); userID != sessionUserID {
+		t.Errorf("Read want: %s got: %s", sessionUserID, userID)
+	}
+	// The session expires in the store well within the cache's TTL.
+	clock.Advance(2 * time.Minute)
+	if userID, _, _ := cache.Read("A"); userID != "" {
+		t.Errorf("Read of an expired session want: empty got: %s", userID)
+	}
+}
+
+func TestCachedSessionManagerExtensions(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	// The cache implements SessionLister, but the manager it wraps does not,
+	// so the session limit cannot be enforced and logins proceed.
+	cache := wares.NewCachedSessionManager(plainManager{manager}, nil)
+	app := forest.New("")
+	wares.InstallSessionWares(app, cache,
+		wares.WithSessionLimit(1, wares.LimitReject))
+	app.RegisterRoute(root, &memoryRouter{app})
+	login(t, app)
+	login(t, app)
+}
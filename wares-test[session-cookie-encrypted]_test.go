@@ -0,0 +1,83 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares_test
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ursiform/forest"
+	"github.com/ursiform/forest-wares"
+)
+
+func newEncryptedCookieApp(t *testing.T, keys wares.Keyring) *forest.App {
+	manager, err := wares.NewEncryptedCookieSessionManager(&wares.CookieConfig{
+		Keys:    keys,
+		NewUser: func() interface{} { return new(memoryUser) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := forest.New("")
+	wares.InstallCookieSessionWares(app, manager)
+	app.RegisterRoute(root, &memoryRouter{app})
+	return app
+}
+
+func TestEncryptedCookieSessionConfigError(t *testing.T) {
+	if _, err := wares.NewEncryptedCookieSessionManager(nil); err == nil {
+		t.Errorf("NewEncryptedCookieSessionManager should fail without a key")
+	}
+	for _, keys := range []wares.Keyring{
+		{Current: []byte("short")},
+		{Current: cookieKeyCurrent, Previous: [][]byte{[]byte("short")}}} {
+		config := &wares.CookieConfig{Keys: keys}
+		if _, err := wares.NewEncryptedCookieSessionManager(config); err == nil {
+			t.Errorf("NewEncryptedCookieSessionManager should reject bad keys")
+		}
+	}
+}
+
+func TestEncryptedCookieSessionKeyRotation(t *testing.T) {
+	old := newEncryptedCookieApp(t, wares.Keyring{Current: cookieKeyPrevious})
+	auth := login(t, old)
+	rotated := newEncryptedCookieApp(t, wares.Keyring{
+		Current:  cookieKeyCurrent,
+		Previous: [][]byte{cookieKeyPrevious}})
+	params := &requested{auth: auth, method: "GET", path: root + "/user"}
+	want := &wanted{code: http.StatusOK, success: true}
+	response, _ := makeRequest(t, rotated, params, want)
+	if response == nil {
+		t.FailNow()
+	}
+	reissued := sessionCookie(response)
+	retired := newEncryptedCookieApp(t, wares.Keyring{Current: cookieKeyCurrent})
+	want = &wanted{code: http.StatusUnauthorized, success: false}
+	makeRequest(t, retired, params, want)
+	params = &requested{auth: reissued, method: "GET", path: root + "/user"}
+	want = &wanted{code: http.StatusOK, success: true}
+	makeRequest(t, retired, params, want)
+}
+
+func TestEncryptedCookieSessionLifecycle(t *testing.T) {
+	app := newEncryptedCookieApp(t, wares.Keyring{Current: cookieKeyCurrent})
+	auth := login(t, app)
+	sealed, err := base64.RawURLEncoding.DecodeString(auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(sealed), sessionUserID) {
+		t.Errorf("encrypted cookie should not reveal the session payload")
+	}
+	params := &requested{auth: auth, method: "GET", path: root + "/user"}
+	want := &wanted{code: http.StatusOK, success: true}
+	makeRequest(t, app, params, want)
+	want = &wanted{code: http.StatusUnauthorized, success: false}
+	for _, value := range []string{"!", "AAAA", auth[:len(auth)-2] + "AA"} {
+		params = &requested{auth: value, method: "GET", path: root + "/user"}
+		makeRequest(t, app, params, want)
+	}
+}
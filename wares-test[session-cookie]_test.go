@@ -0,0 +1,269 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ursiform/forest"
+	"github.com/ursiform/forest-wares"
+)
+
+var (
+	cookieKeyCurrent  = []byte("0123456789abcdef0123456789abcdef")
+	cookieKeyPrevious = []byte("fedcba9876543210fedcba9876543210")
+)
+
+// implements EpochStore
+type failingEpochs struct{}
+
+func (epochs failingEpochs) Epoch(userID string) (int64, error) {
+	return 0, errors.New("epochs.Epoch error")
+}
+func (epochs failingEpochs) Increment(userID string) error {
+	return errors.New("epochs.Increment error")
+}
+
+func newCookieApp(t *testing.T,
+	config *wares.CookieConfig) (*forest.App, *wares.CookieSessionManager) {
+	config.NewUser = func() interface{} { return new(memoryUser) }
+	manager, err := wares.NewSignedCookieSessionManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := forest.New("")
+	wares.InstallCookieSessionWares(app, manager)
+	app.RegisterRoute(root, &memoryRouter{app})
+	return app, manager
+}
+
+func login(t *testing.T, app *forest.App) string {
+	params := &requested{method: "GET", path: root + "/login"}
+	want := &wanted{code: http.StatusOK, success: true}
+	response, _ := makeRequest(t, app, params, want)
+	if response == nil {
+		t.FailNow()
+	}
+	return sessionCookie(response)
+}
+
+func TestCookieSessionAnonymous(t *testing.T) {
+	app, _ := newCookieApp(t,
+		&wares.CookieConfig{Keys: wares.Keyring{Current: cookieKeyCurrent}})
+	params := &requested{method: "GET", path: root + "/user"}
+	want := &wanted{code: http.StatusUnauthorized, success: false}
+	response, _ := makeRequest(t, app, params, want)
+	auth := sessionCookie(response)
+	if auth == "" {
+		t.Fatalf("anonymous session should set a cookie")
+	}
+	params = &requested{auth: auth, method: "GET", path: root + "/user"}
+	response, _ = makeRequest(t, app, params, want)
+	if sessionCookie(response) != "" {
+		t.Errorf("valid anonymous session should not be reissued")
+	}
+}
+
+func TestCookieSessionConfigError(t *testing.T) {
+	if _, err := wares.NewSignedCookieSessionManager(nil); err == nil {
+		t.Errorf("NewSignedCookieSessionManager should fail without a key")
+	}
+}
+
+func TestCookieSessionEpochError(t *testing.T) {
+	app, manager := newCookieApp(t, &wares.CookieConfig{
+		Epochs: failingEpochs{},
+		Keys:   wares.Keyring{Current: cookieKeyCurrent}})
+	params := &requested{method: "GET", path: root + "/login"}
+	want := &wanted{code: http.StatusInternalServerError, success: false}
+	makeRequest(t, app, params, want)
+	if err := manager.Revoke(sessionUserID); err == nil {
+		t.Errorf("Revoke should propagate EpochStore errors")
+	}
+	good, _ := newCookieApp(t,
+		&wares.CookieConfig{Keys: wares.Keyring{Current: cookieKeyCurrent}})
+	auth := login(t, good)
+	if _, _, err := manager.Read(auth); err == nil {
+		t.Errorf("Read should propagate EpochStore errors")
+	}
+	params = &requested{auth: auth, method: "GET", path: root + "/user"}
+	want = &wanted{code: http.StatusUnauthorized, success: false}
+	makeRequest(t, app, params, want)
+}
+
+func TestCookieSessionManager(t *testing.T) {
+	_, manager := newCookieApp(t,
+		&wares.CookieConfig{Keys: wares.Keyring{Current: cookieKeyCurrent}})
+	value, err := manager.Encode(sessionIDExistent, sessionUserID,
+		sessionUserJSON, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, userJSON, err := manager.Read(value)
+	if err != nil || userID != sessionUserID || userJSON != sessionUserJSON {
+		t.Errorf("Read want: %s %s got: %s %s (%v)",
+			sessionUserID, sessionUserJSON, userID, userJSON, err)
+	}
+	if manager.Update(value, userID, userJSON, time.Hour) != nil ||
+		manager.Delete(value, userID) != nil {
+		t.Errorf("Update and Delete should be no-ops")
+	}
+	expired, _ := manager.Encode(sessionIDExistent, sessionUserID,
+		sessionUserJSON, -time.Hour)
+	payload := strings.Split(value, ".")[0]
+	for _, value := range []string{expired, "", "a.b.c", payload + ".!",
+		"!." + strings.Split(value, ".")[1], payload + ".AAAA"} {
+		if userID, _, _ := manager.Read(value); userID != "" {
+			t.Errorf("Read should reject %q", value)
+		}
+	}
+	_, err = manager.Encode(sessionIDExistent, sessionUserID,
+		strings.Repeat("x", 4096), time.Hour)
+	if err == nil {
+		t.Errorf("Encode should reject oversized cookies")
+	}
+}
+
+func TestCookieSessionKeyRotation(t *testing.T) {
+	old, _ := newCookieApp(t,
+		&wares.CookieConfig{Keys: wares.Keyring{Current: cookieKeyPrevious}})
+	auth := login(t, old)
+	rotated, _ := newCookieApp(t, &wares.CookieConfig{Keys: wares.Keyring{
+		Current:  cookieKeyCurrent,
+		Previous: [][]byte{cookieKeyPrevious}}})
+	params := &requested{auth: auth, method: "GET", path: root + "/user"}
+	want := &wanted{code: http.StatusOK, success: true}
+	response, _ := makeRequest(t, rotated, params, want)
+	reissued := sessionCookie(response)
+	retired, _ := newCookieApp(t,
+		&wares.CookieConfig{Keys: wares.Keyring{Current: cookieKeyCurrent}})
+	want = &wanted{code: http.StatusUnauthorized, success: false}
+	makeRequest(t, retired, params, want)
+	params = &requested{auth: reissued, method: "GET", path: root + "/user"}
+	want = &wanted{code: http.StatusOK, success: true}
+	makeRequest(t, retired, params, want)
+}
+
+func TestCookieSessionLifecycle(t *testing.T) {
+	app, manager := newCookieApp(t,
+		&wares.CookieConfig{Keys: wares.Keyring{Current: cookieKeyCurrent}})
+	auth := login(t, app)
+	params := &requested{auth: auth, method: "GET", path: root + "/user"}
+	want := &wanted{code: http.StatusOK, success: true}
+	_, forestResponse := makeRequest(t, app, params, want)
+	if forestResponse.Message != sessionUserID {
+		t.Errorf("session user want: %s got: %s",
+			sessionUserID, forestResponse.Message)
+	}
+	// Tampering with the payload invalidates the signature.
+	tampered := "x" + auth
+	params = &requested{auth: tampered, method: "GET", path: root + "/user"}
+	want = &wanted{code: http.StatusUnauthorized, success: false}
+	makeRequest(t, app, params, want)
+	// A payload that does not decode as the user yields an empty session.
+	value, _ := manager.Encode(sessionIDExistent, sessionUserID,
+		"[]", time.Hour)
+	params = &requested{auth: value, method: "GET", path: root + "/user"}
+	makeRequest(t, app, params, want)
+	// Logging out clears the cookie.
+	params = &requested{auth: auth, method: "GET", path: root + "/logout"}
+	want = &wanted{code: http.StatusOK, success: true}
+	response, _ := makeRequest(t, app, params, want)
+	if response != nil && sessionCookie(response) != "" {
+		t.Errorf("SessionDel should clear the session cookie")
+	}
+	// Revoking a user invalidates every cookie issued to them.
+	if err := manager.Revoke(sessionUserID); err != nil {
+		t.Fatal(err)
+	}
+	params = &requested{auth: auth, method: "GET", path: root + "/user"}
+	want = &wanted{code: http.StatusUnauthorized, success: false}
+	makeRequest(t, app, params, want)
+	auth = login(t, app)
+	params = &requested{auth: auth, method: "GET", path: root + "/user"}
+	want = &wanted{code: http.StatusOK, success: true}
+	makeRequest(t, app, params, want)
+	// Marshal fails when forest.SessionUser is not set.
+	params = &requested{method: "GET", path: root + "/login/no-user"}
+	want = &wanted{code: http.StatusInternalServerError, success: false}
+	makeRequest(t, app, params, want)
+}
+
+func TestCookieSessionRevokeOthers(t *testing.T) {
+	app, _ := newCookieApp(t,
+		&wares.CookieConfig{Keys: wares.Keyring{Current: cookieKeyCurrent}})
+	current, other := login(t, app), login(t, app)
+	params := &requested{
+		auth: current, method: "GET", path: root + "/revoke/others"}
+	want := &wanted{code: http.StatusOK, success: true}
+	response, _ := makeRequest(t, app, params, want)
+	reissued := sessionCookie(response)
+	if reissued == "" {
+		t.Fatalf("SessionRevokeOthers should reissue the current cookie")
+	}
+	params = &requested{auth: reissued, method: "GET", path: root + "/user"}
+	makeRequest(t, app, params, want)
+	params = &requested{auth: other, method: "GET", path: root + "/user"}
+	want = &wanted{code: http.StatusUnauthorized, success: false}
+	makeRequest(t, app, params, want)
+	// Revoking every session does not reissue the current cookie.
+	params = &requested{auth: reissued, method: "GET", path: root + "/revoke"}
+	want = &wanted{code: http.StatusOK, success: true}
+	makeRequest(t, app, params, want)
+	params = &requested{auth: reissued, method: "GET", path: root + "/user"}
+	want = &wanted{code: http.StatusUnauthorized, success: false}
+	makeRequest(t, app, params, want)
+}
+
+func TestCookieSessionGenericWares(t *testing.T) {
+	manager, err := wares.NewSignedCookieSessionManager(&wares.CookieConfig{
+		Keys:    wares.Keyring{Current: cookieKeyCurrent},
+		NewUser: func() interface{} { return new(memoryUser) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The wares for stored sessions would silently lose cookie sessions.
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager)
+	app.RegisterRoute(root, &memoryRouter{app})
+	for _, path := range []string{"/login", "/user", "/revoke/others"} {
+		params := &requested{method: "GET", path: root + path}
+		want := &wanted{code: http.StatusInternalServerError, success: false}
+		makeRequest(t, app, params, want)
+	}
+}
+
+func TestCookieSessionCookieOptions(t *testing.T) {
+	manager, err := wares.NewSignedCookieSessionManager(
+		&wares.CookieConfig{Keys: wares.Keyring{Current: cookieKeyCurrent}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := forest.New("")
+	wares.InstallCookieSessionWares(app, manager,
+		wares.WithCookie(wares.CookieOptions{Domain: "example.com", Name: "sid"}))
+	app.RegisterRoute(root, &memoryRouter{app})
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, httptest.NewRequest("GET", root+"/login", nil))
+	cookies := (&http.Response{Header: response.Header()}).Cookies()
+	cookie := cookies[len(cookies)-1]
+	if cookie.Name != "sid" || cookie.Domain != "example.com" ||
+		cookie.Path != "/" || !cookie.HttpOnly || cookie.Secure {
+		t.Errorf("unexpected session cookie: %s", cookie)
+	}
+	request := httptest.NewRequest("GET", root+"/logout", nil)
+	request.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	response = httptest.NewRecorder()
+	app.ServeHTTP(response, request)
+	cookies = (&http.Response{Header: response.Header()}).Cookies()
+	if cookie := cookies[len(cookies)-1]; cookie.MaxAge >= 0 {
+		t.Errorf("logout should expire the session cookie: %s", cookie)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ursiform/forest"
+	"github.com/ursiform/forest-wares"
+)
+
+const legacyUserJSON = `{"name":"legacy-user"}`
+
+func newMigrationApp(manager wares.SessionManager, version int,
+	migrations wares.Migrations) *forest.App {
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager,
+		wares.WithMigrations(version, migrations))
+	app.RegisterRoute(root, &memoryRouter{app})
+	return app
+}
+
+func TestSessionMigrations(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	calls := 0
+	migrations := wares.Migrations{
+		// Version 1 renamed the "name" field to "id".
+		0: func(userJSON []byte) ([]byte, error) {
+			calls++
+			var legacy struct{ Name string }
+			if err := json.Unmarshal(userJSON, &legacy); err != nil {
+				return nil, err
+			}
+			return json.Marshal(map[string]string{"id": legacy.Name})
+		},
+		1: func(userJSON []byte) ([]byte, error) {
+			calls++
+			return userJSON, nil
+		}}
+	app := newMigrationApp(manager, 2, migrations)
+	manager.Update("legacy", sessionUserID, legacyUserJSON, time.Hour)
+	params := &requested{auth: "legacy", method: "GET", path: root + "/user"}
+	want := &wanted{code: http.StatusOK, success: true}
+	_, response := makeRequest(t, app, params, want)
+	if response == nil || response.Message != "legacy-user" {
+		t.Fatalf("a legacy session should be migrated: %+v", response)
+	}
+	if calls != 2 {
+		t.Errorf("migrations want: 2 calls got: %d", calls)
+	}
+	// The migrated session is stored again, so it is only migrated once.
+	_, userJSON, _ := manager.Read("legacy")
+	if !strings.Contains(userJSON, `"version":2`) {
+		t.Errorf("a refreshed session should be stored as version 2: %s",
+			userJSON)
+	}
+	makeRequest(t, app, params, want)
+	if calls != 2 {
+		t.Errorf("a current session should not be migrated")
+	}
+	// Sessions stored by the wares are stamped with the current version.
+	auth := login(t, app)
+	if _, userJSON, _ = manager.Read(auth); !strings.Contains(userJSON,
+		`"version":2`) {
+		t.Errorf("SessionSet should store version 2: %s", userJSON)
+	}
+	params = &requested{auth: auth, method: "GET", path: root + "/revoke/others"}
+	makeRequest(t, app, params, want)
+	if _, userJSON, _ = manager.Read(auth); !strings.Contains(userJSON,
+		`"version":2`) {
+		t.Errorf("SessionRevokeOthers should store version 2: %s", userJSON)
+	}
+	params = &requested{auth: auth, method: "GET", path: root + "/user"}
+	makeRequest(t, app, params, want)
+	if calls != 2 {
+		t.Errorf("a current session should not be migrated")
+	}
+}
+
+func TestSessionMigrationFailure(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	failing := wares.Migrations{0: func(userJSON []byte) ([]byte, error) {
+		return nil, errors.New("migration error")
+	}}
+	tests := []struct {
+		name       string
+		version    int
+		migrations wares.Migrations
+		userJSON   string
+	}{
+		{"missing", 1, nil, legacyUserJSON},
+		{"failing", 1, failing, legacyUserJSON},
+		{"newer", 0, nil, `{"$wares":{"version":1},"user":{"id":"newer"}}`}}
+	for _, test := range tests {
+		app := newMigrationApp(manager, test.version, test.migrations)
+		manager.Update(test.name, sessionUserID, test.userJSON, time.Hour)
+		params := &requested{auth: test.name, method: "GET",
+			path: root + "/user"}
+		want := &wanted{code: http.StatusUnauthorized, success: false}
+		makeRequest(t, app, params, want)
+		// A session that cannot be migrated is left intact.
+		if _, userJSON, _ := manager.Read(test.name); userJSON != test.userJSON {
+			t.Errorf("%s session want: %s got: %s",
+				test.name, test.userJSON, userJSON)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ursiform/forest-wares"
+)
+
+func sessionFile(dir string, sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".session")
+}
+
+func TestFileSessionManagerConfigError(t *testing.T) {
+	if _, err := wares.NewFileSessionManager(nil); err == nil {
+		t.Errorf("NewFileSessionManager should fail without Dir")
+	}
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, nil, 0600)
+	config := &wares.FileConfig{Dir: filepath.Join(file, "sessions")}
+	if _, err := wares.NewFileSessionManager(config); err == nil {
+		t.Errorf("NewFileSessionManager should fail if Dir cannot be created")
+	}
+}
+
+func TestFileSessionManagerExpiry(t *testing.T) {
+	dir := t.TempDir()
+	config := &wares.FileConfig{Dir: dir, SweepInterval: 5 * time.Millisecond}
+	manager, err := wares.NewFileSessionManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+	duration := 10 * time.Millisecond
+	manager.Update(sessionIDExistent, sessionUserID, sessionUserJSON, duration)
+	if userID, _, _ := manager.Read(sessionIDExistent); userID != sessionUserID {
+		t.Errorf("Read want: %s got: %s", sessionUserID, userID)
+	}
+	time.Sleep(4 * duration)
+	if userID, _, _ := manager.Read(sessionIDExistent); userID != "" {
+		t.Errorf("Read should not return expired session, got: %s", userID)
+	}
+	if _, err := os.Stat(sessionFile(dir, sessionIDExistent)); err == nil {
+		t.Errorf("expired session file should be swept")
+	}
+	manager.Update(sessionIDExistent, sessionUserID, sessionUserJSON, time.Hour)
+	manager.Update(sessionIDExistent, sessionUserID, sessionUserJSON, 0)
+	if userID, _, _ := manager.Read(sessionIDExistent); userID != "" {
+		t.Errorf("Read should not return expired session, got: %s", userID)
+	}
+}
+
+func TestFileSessionManagerLifecycle(t *testing.T) {
+	dir := t.TempDir()
+	manager, err := wares.NewFileSessionManager(&wares.FileConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+	if userID, _, err := manager.Read(sessionIDNonExistent); err != nil ||
+		userID != "" {
+		t.Errorf("Read of nonexistent session should be empty")
+	}
+	manager.Update(sessionIDExistent, sessionUserID, sessionUserJSON, time.Hour)
+	info, _ := manager.ReadInfo(sessionIDExistent)
+	manager.Update(sessionIDExistent, sessionUserID, sessionUserJSON, time.Hour)
+	if updated, err := manager.ReadInfo(sessionIDExistent); err != nil ||
+		updated == nil || !updated.Created.Equal(info.Created) {
+		t.Errorf("Update should not change session creation time")
+	}
+	if err := manager.Touch(sessionIDExistent, "192.0.2.1", "agent"); err != nil {
+		t.Error(err)
+	}
+	manager.Update(sessionIDExistent, sessionUserID, sessionUserJSON, time.Hour)
+	info, _ = manager.ReadInfo(sessionIDExistent)
+	if info.IP != "192.0.2.1" || info.UserAgent != "agent" ||
+		info.LastSeen.IsZero() {
+		t.Errorf("Touch should record session metadata, got: %+v", info)
+	}
+	manager.SetFingerprint(sessionIDExistent, "first")
+	manager.SetFingerprint(sessionIDExistent, "second")
+	manager.Update(sessionIDExistent, sessionUserID, sessionUserJSON, time.Hour)
+	if info, _ = manager.ReadInfo(sessionIDExistent); info.Fingerprint != "first" {
+		t.Errorf("SetFingerprint should not rebind a session, got: %s",
+			info.Fingerprint)
+	}
+	if err := manager.SetFingerprint(sessionIDNonExistent, ""); err != nil {
+		t.Errorf("SetFingerprint of nonexistent session should be a no-op")
+	}
+	if err := manager.Touch(sessionIDNonExistent, "", ""); err != nil {
+		t.Errorf("Touch of nonexistent session should be a no-op (%v)", err)
+	}
+	userID, userJSON, err := manager.Read(sessionIDExistent)
+	if err != nil || userID != sessionUserID || userJSON != sessionUserJSON {
+		t.Errorf("Read want: %s %s got: %s %s (%v)",
+			sessionUserID, sessionUserJSON, userID, userJSON, err)
+	}
+	if err := manager.Delete(sessionIDExistent, sessionUserID); err != nil {
+		t.Error(err)
+	}
+	if userID, _, _ := manager.Read(sessionIDExistent); userID != "" {
+		t.Errorf("Read should not return deleted session, got: %s", userID)
+	}
+	// Corrupt files surface as read errors.
+	os.WriteFile(sessionFile(dir, sessionIDExistent), []byte("{"), 0600)
+	if _, _, err := manager.Read(sessionIDExistent); err == nil {
+		t.Errorf("Read of corrupt session should fail")
+	}
+	if err := manager.Touch(sessionIDExistent, "", ""); err == nil {
+		t.Errorf("Touch of corrupt session should fail")
+	}
+	if err := manager.SetFingerprint(sessionIDExistent, ""); err == nil {
+		t.Errorf("SetFingerprint of corrupt session should fail")
+	}
+	// Writes fail once the directory is gone.
+	os.RemoveAll(dir)
+	err = manager.Update(sessionIDExistent, sessionUserID,
+		sessionUserJSON, time.Hour)
+	if err == nil {
+		t.Errorf("Update should fail when directory is missing")
+	}
+	if err := manager.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFileSessionManagerRecovery(t *testing.T) {
+	dir := t.TempDir()
+	manager, err := wares.NewFileSessionManager(&wares.FileConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.Update("A", sessionUserID, sessionUserJSON, time.Hour)
+	manager.Update("B", sessionUserID, sessionUserJSON, time.Hour)
+	manager.Update("C", "OTHER-USER-ID", arbitraryJSON, time.Hour)
+	manager.Update("D", "OTHER-USER-ID", arbitraryJSON, time.Millisecond)
+	manager.Close()
+	// Simulate an interrupted write, a corrupt session, and unrelated files.
+	temporary := filepath.Join(dir, ".tmp-12345")
+	corrupt := sessionFile(dir, "E")
+	os.WriteFile(temporary, []byte("{"), 0600)
+	os.WriteFile(corrupt, []byte("{"), 0600)
+	os.WriteFile(filepath.Join(dir, "README"), nil, 0600)
+	os.Mkdir(filepath.Join(dir, "subdir"), 0700)
+	time.Sleep(5 * time.Millisecond)
+	manager, err = wares.NewFileSessionManager(&wares.FileConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+	for _, path := range []string{temporary, corrupt, sessionFile(dir, "D")} {
+		if _, err := os.Stat(path); err == nil {
+			t.Errorf("recovery should remove %s", filepath.Base(path))
+		}
+	}
+	if userID, _, _ := manager.Read("A"); userID != sessionUserID {
+		t.Errorf("sessions should survive restart")
+	}
+	sessions, err := manager.ListSessions(sessionUserID)
+	if err != nil || len(sessions) != 2 {
+		t.Errorf("ListSessions want: 2 sessions got: %d (%v)",
+			len(sessions), err)
+	}
+	os.WriteFile(sessionFile(dir, "B"), []byte("{"), 0600)
+	if _, err := manager.ListSessions(sessionUserID); err == nil {
+		t.Errorf("ListSessions of corrupt session should fail")
+	}
+	if err := manager.Revoke(sessionUserID); err != nil {
+		t.Fatal(err)
+	}
+	for _, sessionID := range []string{"A", "B"} {
+		if userID, _, _ := manager.Read(sessionID); userID != "" {
+			t.Errorf("Revoke should delete session %s after restart", sessionID)
+		}
+	}
+	if userID, _, _ := manager.Read("C"); userID != "OTHER-USER-ID" {
+		t.Errorf("Revoke should not delete other users' sessions")
+	}
+}
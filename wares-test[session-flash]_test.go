@@ -0,0 +1,149 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ursiform/bear"
+	"github.com/ursiform/forest"
+	"github.com/ursiform/forest-wares"
+)
+
+type flashRouter struct{ memoryRouter }
+
+func (app *flashRouter) addFlash(ctx *bear.Context) {
+	wares.AddFlash(ctx, wares.Flash{Kind: "info", Message: ctx.Request.URL.Path})
+	ctx.Next()
+}
+func (app *flashRouter) respondFlashes(ctx *bear.Context) {
+	flashes, _ := ctx.Get(wares.Flashes).([]wares.Flash)
+	app.Response(ctx, http.StatusOK,
+		forest.Success, forest.NoMessage).Write(flashes)
+}
+
+func (app *flashRouter) Route(path string) {
+	app.memoryRouter.Route(path)
+	app.On("GET", path+"/flash/add",
+		app.Ware("SessionGet"),
+		app.addFlash,
+		app.Ware("FlashSet"),
+		app.respondFlashes)
+	app.On("GET", path+"/flash/login",
+		app.Ware("SessionGet"),
+		app.login,
+		app.addFlash,
+		app.Ware("SessionSet"),
+		app.respondUser)
+	app.On("GET", path+"/flash/logout",
+		app.Ware("SessionGet"),
+		app.Ware("SessionDel"),
+		app.addFlash,
+		app.Ware("FlashSet"),
+		app.respondFlashes)
+	app.On("GET", path+"/flash/show",
+		app.Ware("SessionGet"),
+		app.Ware("FlashGet"),
+		app.respondFlashes)
+}
+
+func newFlashApp(manager wares.SessionManager,
+	opts ...wares.Option) *forest.App {
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager, opts...)
+	app.RegisterRoute(root, &flashRouter{memoryRouter{app}})
+	return app
+}
+
+// showFlashes requests the flash messages of a session and returns how many
+// were delivered.
+func showFlashes(t *testing.T, app *forest.App, auth string) int {
+	params := &requested{auth: auth, method: "GET", path: root + "/flash/show"}
+	want := &wanted{code: http.StatusOK, success: true}
+	_, response := makeRequest(t, app, params, want)
+	flashes, _ := response.Data.([]interface{})
+	return len(flashes)
+}
+
+func TestFlashAnonymous(t *testing.T) {
+	for _, opts := range [][]wares.Option{nil, {wares.WithLazySessions()}} {
+		manager := newMemoryManager()
+		defer manager.Close()
+		app := newFlashApp(manager, opts...)
+		params := &requested{method: "GET", path: root + "/flash/add"}
+		want := &wanted{code: http.StatusOK, success: true}
+		response, _ := makeRequest(t, app, params, want)
+		if response == nil {
+			t.FailNow()
+		}
+		auth := sessionCookie(response)
+		if count := showFlashes(t, app, auth); count != 1 {
+			t.Errorf("FlashGet want: 1 flash got: %d", count)
+		}
+		if count := showFlashes(t, app, auth); count != 0 {
+			t.Errorf("FlashGet should deliver a flash once, got: %d", count)
+		}
+		if info, _ := manager.ReadInfo(auth); info != nil {
+			t.Errorf("an anonymous session without flashes should be deleted")
+		}
+	}
+}
+
+func TestFlashAnonymousPlainManager(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	app := newFlashApp(plainManager{manager})
+	params := &requested{method: "GET", path: root + "/flash/add"}
+	want := &wanted{code: http.StatusOK, success: true}
+	response, _ := makeRequest(t, app, params, want)
+	if response == nil {
+		t.FailNow()
+	}
+	auth := sessionCookie(response)
+	if count := showFlashes(t, app, auth); count != 1 {
+		t.Errorf("FlashGet without SessionInfoReader want: 1 flash got: %d",
+			count)
+	}
+}
+
+func TestFlashAuthenticated(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	app := newFlashApp(manager)
+	params := &requested{method: "GET", path: root + "/flash/login"}
+	want := &wanted{code: http.StatusOK, success: true}
+	response, _ := makeRequest(t, app, params, want)
+	if response == nil {
+		t.FailNow()
+	}
+	auth := sessionCookie(response)
+	// Flashes survive session regeneration.
+	params = &requested{auth: auth, method: "GET", path: root + "/flash/add"}
+	makeRequest(t, app, params, want)
+	params = &requested{auth: auth, method: "GET",
+		path: root + "/login/regenerate"}
+	if response, _ = makeRequest(t, app, params, want); response == nil {
+		t.FailNow()
+	}
+	auth = sessionCookie(response)
+	if count := showFlashes(t, app, auth); count != 2 {
+		t.Errorf("FlashGet want: 2 flashes got: %d", count)
+	}
+	params = &requested{auth: auth, method: "GET", path: root + "/user"}
+	makeRequest(t, app, params, want)
+	if count := showFlashes(t, app, auth); count != 0 {
+		t.Errorf("FlashGet should deliver a flash once, got: %d", count)
+	}
+	// A flash added after logging out outlives the session.
+	params = &requested{auth: auth, method: "GET", path: root + "/flash/logout"}
+	makeRequest(t, app, params, want)
+	params = &requested{auth: auth, method: "GET", path: root + "/user"}
+	want = &wanted{code: http.StatusUnauthorized, success: false}
+	makeRequest(t, app, params, want)
+	if count := showFlashes(t, app, auth); count != 1 {
+		t.Errorf("FlashGet want: 1 flash after logout got: %d", count)
+	}
+}
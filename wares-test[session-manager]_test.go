@@ -10,8 +10,28 @@ import (
 
 	"github.com/ursiform/bear"
 	"github.com/ursiform/forest"
+	"github.com/ursiform/forest-wares"
 )
 
+// implements SessionManager, hiding the optional extensions of the one it
+// wraps
+type plainManager struct{ wares.SessionManager }
+
+// implements SessionManager and every optional extension but SessionLister
+type unlistedManager struct {
+	wares.SessionManager
+	wares.SessionFingerprinter
+	wares.SessionInfoReader
+	wares.SessionToucher
+}
+
+// implements SessionManager and SessionFingerprinter, but cannot read the
+// fingerprints back
+type unreadableManager struct {
+	wares.SessionManager
+	wares.SessionFingerprinter
+}
+
 // implements SessionManager
 type sessionManager struct{}
 
@@ -56,11 +76,16 @@ func (manager *sessionManager) Read(sessionID string) (userID string,
 	userJSON string, err error) {
 	if sessionID == sessionIDNonExistent {
 		return "", "", nil
+	} else if sessionID == sessionIDWithRevokeError {
+		return sessionUserIDWithRevokeError, sessionUserJSON, nil
 	} else {
 		return sessionUserID, sessionUserJSON, nil
 	}
 }
 func (manager *sessionManager) Revoke(userID string) error {
+	if userID == sessionUserIDWithRevokeError {
+		return errors.New("manager.Revoke error")
+	}
 	return nil
 }
 func (manager *sessionManager) Update(sessionID string, userID string,
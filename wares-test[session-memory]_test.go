@@ -0,0 +1,674 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ursiform/bear"
+	"github.com/ursiform/forest"
+	"github.com/ursiform/forest-wares"
+)
+
+type memoryUser struct {
+	ID string `json:"id"`
+}
+
+type memoryRouter struct{ *forest.App }
+
+func (app *memoryRouter) login(ctx *bear.Context) {
+	ctx.Set(forest.SessionUserID, sessionUserID)
+	ctx.Set(forest.SessionUser, &memoryUser{ID: sessionUserID})
+	ctx.Next()
+}
+func (app *memoryRouter) loginWithoutUser(ctx *bear.Context) {
+	ctx.Set(forest.SessionUserID, sessionUserID)
+	ctx.Next()
+}
+func (app *memoryRouter) respondUser(ctx *bear.Context) {
+	user, ok := ctx.Get(forest.SessionUser).(*memoryUser)
+	if !ok {
+		app.Response(ctx, http.StatusUnauthorized,
+			forest.Failure, forest.NoMessage).Write(nil)
+		return
+	}
+	app.Response(ctx, http.StatusOK, forest.Success, user.ID).Write(nil)
+}
+func (app *memoryRouter) respondUserID(ctx *bear.Context) {
+	userID, ok := ctx.Get(forest.SessionUserID).(string)
+	if !ok {
+		app.Response(ctx, http.StatusUnauthorized,
+			forest.Failure, forest.NoMessage).Write(nil)
+		return
+	}
+	app.Response(ctx, http.StatusOK, forest.Success, userID).Write(nil)
+}
+
+func (app *memoryRouter) Route(path string) {
+	app.On("GET", path+"/login",
+		app.Ware("SessionGet"),
+		app.login,
+		app.Ware("SessionSet"),
+		app.respondUser)
+	app.On("GET", path+"/login/regenerate",
+		app.Ware("SessionGet"),
+		app.login,
+		app.Ware("SessionRegenerate"),
+		app.respondUser)
+	app.On("GET", path+"/login/logout",
+		app.Ware("SessionGet"),
+		app.login,
+		app.Ware("SessionDel"),
+		app.respondUser)
+	app.On("GET", path+"/login/no-user",
+		app.Ware("SessionGet"),
+		app.loginWithoutUser,
+		app.Ware("SessionSet"),
+		app.respondUser)
+	app.On("GET", path+"/logout",
+		app.Ware("SessionGet"),
+		app.Ware("SessionDel"),
+		app.respondUser)
+	app.On("GET", path+"/revoke",
+		app.Ware("SessionGet"),
+		app.Ware("SessionRevoke"),
+		app.respondUser)
+	app.On("GET", path+"/revoke/others",
+		app.Ware("SessionGet"),
+		app.Ware("SessionRevokeOthers"),
+		app.respondUser)
+	app.On("GET", path+"/sessions",
+		app.Ware("SessionGet"),
+		app.Ware("SessionList"))
+	app.On("DELETE", path+"/sessions/:id",
+		app.Ware("SessionGet"),
+		app.Ware("SessionDelByID"),
+		app.respondUserID)
+	app.On("GET", path+"/user",
+		app.Ware("SessionGet"),
+		app.respondUser)
+	app.On("GET", path+"/user-id",
+		app.Ware("SessionGet"),
+		app.respondUserID)
+}
+
+func newMemoryManager() *wares.MemorySessionManager {
+	return wares.NewMemorySessionManager(&wares.MemoryConfig{
+		NewUser:       func() interface{} { return new(memoryUser) },
+		SweepInterval: 5 * time.Millisecond})
+}
+
+// sessionCookie returns the last session cookie set by a response.
+func sessionCookie(response *http.Response) string {
+	value := ""
+	for _, cookie := range response.Cookies() {
+		if cookie.Name == forest.SessionID {
+			value = cookie.Value
+		}
+	}
+	return value
+}
+
+func TestMemorySessionManagerExpiry(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	duration := 10 * time.Millisecond
+	err := manager.Update(sessionIDExistent, sessionUserID,
+		sessionUserJSON, duration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID, _, _ := manager.Read(sessionIDExistent); userID != sessionUserID {
+		t.Errorf("Read want: %s got: %s", sessionUserID, userID)
+	}
+	time.Sleep(4 * duration)
+	if userID, _, _ := manager.Read(sessionIDExistent); userID != "" {
+		t.Errorf("Read should not return expired session, got: %s", userID)
+	}
+	// A non-positive duration expires a session immediately.
+	manager.Update(sessionIDExistent, sessionUserID, sessionUserJSON, time.Hour)
+	manager.Update(sessionIDExistent, sessionUserID, sessionUserJSON, 0)
+	if userID, _, _ := manager.Read(sessionIDExistent); userID != "" {
+		t.Errorf("Read should not return expired session, got: %s", userID)
+	}
+}
+
+func TestMemorySessionManagerLifecycle(t *testing.T) {
+	manager := wares.NewMemorySessionManager(nil)
+	defer manager.Close()
+	if userID, userJSON, err := manager.Read(sessionIDNonExistent); err != nil ||
+		userID != "" || userJSON != "" {
+		t.Errorf("Read of nonexistent session should be empty")
+	}
+	manager.Update(sessionIDExistent, sessionUserID, sessionUserJSON, time.Hour)
+	userID, userJSON, err := manager.Read(sessionIDExistent)
+	if err != nil || userID != sessionUserID || userJSON != sessionUserJSON {
+		t.Errorf("Read want: %s %s got: %s %s (%v)",
+			sessionUserID, sessionUserJSON, userID, userJSON, err)
+	}
+	manager.Update(sessionIDExistent, "OTHER-USER-ID", arbitraryJSON, time.Hour)
+	manager.Revoke(sessionUserID)
+	if userID, _, _ := manager.Read(sessionIDExistent); userID != "OTHER-USER-ID" {
+		t.Errorf("Update should move session to new user, got: %s", userID)
+	}
+	if err := manager.Delete(sessionIDExistent, "OTHER-USER-ID"); err != nil {
+		t.Error(err)
+	}
+	if err := manager.Delete(sessionIDExistent, "OTHER-USER-ID"); err != nil {
+		t.Error(err)
+	}
+	if userID, _, _ := manager.Read(sessionIDExistent); userID != "" {
+		t.Errorf("Read should not return deleted session, got: %s", userID)
+	}
+	if err := manager.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMemorySessionManagerRevoke(t *testing.T) {
+	manager := wares.NewMemorySessionManager(nil)
+	defer manager.Close()
+	manager.Update("A", sessionUserID, sessionUserJSON, time.Hour)
+	manager.Update("B", sessionUserID, sessionUserJSON, time.Hour)
+	manager.Update("C", "OTHER-USER-ID", arbitraryJSON, time.Hour)
+	manager.Update("D", sessionUserID, sessionUserJSON, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	sessions, err := manager.ListSessions(sessionUserID)
+	if err != nil || len(sessions) != 2 {
+		t.Errorf("ListSessions want: 2 sessions got: %d (%v)",
+			len(sessions), err)
+	}
+	if err := manager.Revoke(sessionUserID); err != nil {
+		t.Fatal(err)
+	}
+	for _, sessionID := range []string{"A", "B"} {
+		if userID, _, _ := manager.Read(sessionID); userID != "" {
+			t.Errorf("Revoke should delete session %s", sessionID)
+		}
+	}
+	if userID, _, _ := manager.Read("C"); userID != "OTHER-USER-ID" {
+		t.Errorf("Revoke should not delete other users' sessions")
+	}
+}
+
+func TestMemorySessionManagerWares(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager)
+	app.RegisterRoute(root, &memoryRouter{app})
+	params := &requested{method: "GET", path: root + "/login"}
+	want := &wanted{code: http.StatusOK, success: true}
+	response, _ := makeRequest(t, app, params, want)
+	if response == nil {
+		return
+	}
+	auth := sessionCookie(response)
+	params = &requested{auth: auth, method: "GET", path: root + "/user"}
+	_, forestResponse := makeRequest(t, app, params, want)
+	if forestResponse.Message != sessionUserID {
+		t.Errorf("session user want: %s got: %s",
+			sessionUserID, forestResponse.Message)
+	}
+	// A stored userJSON that cannot be decoded yields an empty session.
+	manager.Update(auth, sessionUserID, "{BAD JSON}", time.Hour)
+	want = &wanted{code: http.StatusUnauthorized, success: false}
+	makeRequest(t, app, params, want)
+	// Marshal fails when forest.SessionUser is not set.
+	params = &requested{method: "GET", path: root + "/login/no-user"}
+	want = &wanted{code: http.StatusInternalServerError, success: false}
+	makeRequest(t, app, params, want)
+}
+
+func TestMemorySessionManagerRegenerate(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager)
+	app.RegisterRoute(root, &memoryRouter{app})
+	auth := login(t, app)
+	params := &requested{
+		auth: auth, method: "GET", path: root + "/login/regenerate"}
+	want := &wanted{code: http.StatusOK, success: true}
+	response, _ := makeRequest(t, app, params, want)
+	if response == nil {
+		return
+	}
+	regenerated := sessionCookie(response)
+	if regenerated == auth {
+		t.Fatalf("SessionRegenerate should issue a new session ID")
+	}
+	if userID, _, _ := manager.Read(auth); userID != "" {
+		t.Errorf("SessionRegenerate should delete the old session")
+	}
+	if userID, _, _ := manager.Read(regenerated); userID != sessionUserID {
+		t.Errorf("SessionRegenerate should migrate the session")
+	}
+}
+
+func TestMemorySessionManagerSessionRevoke(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager)
+	app.RegisterRoute(root, &memoryRouter{app})
+	current, other := login(t, app), login(t, app)
+	params := &requested{
+		auth: current, method: "GET", path: root + "/revoke/others"}
+	want := &wanted{code: http.StatusOK, success: true}
+	makeRequest(t, app, params, want)
+	if userID, _, _ := manager.Read(other); userID != "" {
+		t.Errorf("SessionRevokeOthers should revoke other sessions")
+	}
+	if userID, _, _ := manager.Read(current); userID != sessionUserID {
+		t.Errorf("SessionRevokeOthers should keep the current session")
+	}
+	params = &requested{auth: current, method: "GET", path: root + "/revoke"}
+	makeRequest(t, app, params, want)
+	if userID, _, _ := manager.Read(current); userID != "" {
+		t.Errorf("SessionRevoke should revoke the current session")
+	}
+}
+
+func TestSessionBinderRawJSON(t *testing.T) {
+	manager := wares.NewMemorySessionManager(nil)
+	defer manager.Close()
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager)
+	app.RegisterRoute(root, &memoryRouter{app})
+	manager.Update(sessionIDExistent, sessionUserID, sessionUserJSON, time.Hour)
+	params := &requested{
+		auth: sessionIDExistent, method: "GET", path: root + "/user-id"}
+	want := &wanted{code: http.StatusOK, success: true}
+	makeRequest(t, app, params, want)
+	manager.Update(sessionIDExistent, sessionUserID, "{BAD JSON}", time.Hour)
+	want = &wanted{code: http.StatusUnauthorized, success: false}
+	makeRequest(t, app, params, want)
+}
+
+func TestSessionAbsoluteTimeout(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	timeout := 60 * time.Millisecond
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager,
+		wares.WithIdleTimeout(time.Hour), wares.WithAbsoluteTimeout(timeout))
+	app.RegisterRoute(root, &memoryRouter{app})
+	auth := login(t, app)
+	info, err := manager.ReadInfo(auth)
+	if err != nil || info == nil {
+		t.Fatalf("ReadInfo should return the session (%v)", err)
+	}
+	if info.Expires.Sub(info.Created) < time.Hour-time.Second {
+		t.Errorf("WithIdleTimeout should set the session duration")
+	}
+	params := &requested{auth: auth, method: "GET", path: root + "/user"}
+	want := &wanted{code: http.StatusOK, success: true}
+	makeRequest(t, app, params, want)
+	if refreshed, _ := manager.ReadInfo(auth); refreshed == nil ||
+		!refreshed.Created.Equal(info.Created) ||
+		refreshed.Expires.After(info.Created.Add(timeout+time.Millisecond)) {
+		t.Errorf("refresh should not extend a session past its absolute cap")
+	}
+	time.Sleep(timeout)
+	want = &wanted{code: http.StatusUnauthorized, success: false}
+	makeRequest(t, app, params, want)
+	if userID, _, _ := manager.Read(auth); userID != "" {
+		t.Errorf("session past its absolute timeout should be deleted")
+	}
+}
+
+func TestSessionIdleTimeout(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	timeout := 20 * time.Millisecond
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager, wares.WithIdleTimeout(timeout))
+	app.RegisterRoute(root, &memoryRouter{app})
+	auth := login(t, app)
+	params := &requested{auth: auth, method: "GET", path: root + "/user"}
+	want := &wanted{code: http.StatusOK, success: true}
+	makeRequest(t, app, params, want)
+	time.Sleep(2 * timeout)
+	want = &wanted{code: http.StatusUnauthorized, success: false}
+	makeRequest(t, app, params, want)
+}
+
+func TestSessionRefreshThreshold(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	duration := 100 * time.Millisecond
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager,
+		wares.WithIdleTimeout(duration), wares.WithRefreshThreshold(0.5))
+	app.RegisterRoute(root, &memoryRouter{app})
+	auth := login(t, app)
+	info, _ := manager.ReadInfo(auth)
+	params := &requested{auth: auth, method: "GET", path: root + "/user"}
+	want := &wanted{code: http.StatusOK, success: true}
+	response, _ := makeRequest(t, app, params, want)
+	if response == nil {
+		t.FailNow()
+	}
+	if sessionCookie(response) != "" {
+		t.Errorf("fresh session should not reset the cookie")
+	}
+	if fresh, _ := manager.ReadInfo(auth); !fresh.Expires.Equal(info.Expires) {
+		t.Errorf("fresh session should not be updated")
+	}
+	time.Sleep(duration * 6 / 10)
+	response, _ = makeRequest(t, app, params, want)
+	if response == nil {
+		t.FailNow()
+	}
+	if sessionCookie(response) != auth {
+		t.Errorf("stale session should reset the cookie")
+	}
+	if stale, _ := manager.ReadInfo(auth); !stale.Expires.After(info.Expires) {
+		t.Errorf("stale session should be updated")
+	}
+}
+
+func TestContextSessionManager(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	store := wares.NewContextSessionManager(manager)
+	if wares.NewContextSessionManager(store) != store {
+		t.Errorf("NewContextSessionManager should not wrap twice")
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := store.UpdateContext(cancelled, sessionIDExistent, sessionUserID,
+		sessionUserJSON, time.Hour)
+	if err != context.Canceled {
+		t.Errorf("UpdateContext want: %v got: %v", context.Canceled, err)
+	}
+	err = store.UpdateContext(context.Background(), sessionIDExistent,
+		sessionUserID, sessionUserJSON, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.ReadContext(cancelled, sessionIDExistent); err == nil {
+		t.Errorf("ReadContext should fail once the context is done")
+	}
+	if err := store.DeleteContext(cancelled, sessionIDExistent,
+		sessionUserID); err == nil {
+		t.Errorf("DeleteContext should fail once the context is done")
+	}
+	if err := store.RevokeContext(cancelled, sessionUserID); err == nil {
+		t.Errorf("RevokeContext should fail once the context is done")
+	}
+	userID, _, err := store.ReadContext(context.Background(), sessionIDExistent)
+	if err != nil || userID != sessionUserID {
+		t.Errorf("ReadContext want: %s got: %s (%v)", sessionUserID, userID, err)
+	}
+	err = store.RevokeContext(context.Background(), sessionUserID)
+	if err != nil {
+		t.Error(err)
+	}
+	if err := store.DeleteContext(context.Background(), sessionIDExistent,
+		sessionUserID); err != nil {
+		t.Error(err)
+	}
+	// The session wares do not honor a session once the request is done.
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager)
+	app.RegisterRoute(root, &memoryRouter{app})
+	auth := login(t, app)
+	request := httptest.NewRequest("GET", root+"/user", nil).
+		WithContext(cancelled)
+	request.AddCookie(&http.Cookie{Name: forest.SessionID, Value: auth})
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, request)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("cancelled request want: %d got: %d",
+			http.StatusUnauthorized, response.Code)
+	}
+}
+
+type countingManager struct {
+	*wares.MemorySessionManager
+	empty int
+}
+
+func (manager *countingManager) CreateEmpty(sessionID string,
+	ctx *bear.Context) {
+	manager.empty++
+	manager.MemorySessionManager.CreateEmpty(sessionID, ctx)
+}
+
+func TestSessionLazy(t *testing.T) {
+	manager := &countingManager{MemorySessionManager: newMemoryManager()}
+	defer manager.Close()
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager, wares.WithLazySessions())
+	app.RegisterRoute(root, &memoryRouter{app})
+	params := &requested{method: "GET", path: root + "/user"}
+	want := &wanted{code: http.StatusUnauthorized, success: false}
+	response, _ := makeRequest(t, app, params, want)
+	if response == nil {
+		t.FailNow()
+	}
+	if sessionCookie(response) != "" || manager.empty != 0 {
+		t.Errorf("anonymous request should not create a session")
+	}
+	for _, path := range []string{"/login", "/login/regenerate"} {
+		params = &requested{method: "GET", path: root + path}
+		want = &wanted{code: http.StatusOK, success: true}
+		response, _ := makeRequest(t, app, params, want)
+		if response == nil {
+			t.FailNow()
+		}
+		auth := sessionCookie(response)
+		if userID, _, _ := manager.Read(auth); userID != sessionUserID {
+			t.Errorf("%s should store the session it sets a cookie for", path)
+		}
+		params = &requested{auth: auth, method: "GET", path: root + "/user"}
+		makeRequest(t, app, params, want)
+	}
+	// Deleting a session that was never stored succeeds without the store.
+	params = &requested{method: "GET", path: root + "/login/logout"}
+	makeRequest(t, app, params, want)
+	if manager.empty != 0 {
+		t.Errorf("lazy sessions should never call CreateEmpty")
+	}
+}
+
+func TestSessionCookieOptions(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager, wares.WithCookie(wares.CookieOptions{
+		Domain:     "example.com",
+		HostPrefix: true,
+		Name:       "sid",
+		Path:       "/api",
+		SameSite:   http.SameSiteStrictMode}))
+	app.RegisterRoute(root, &memoryRouter{app})
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, httptest.NewRequest("GET", root+"/login", nil))
+	cookies := (&http.Response{Header: response.Header()}).Cookies()
+	if len(cookies) == 0 {
+		t.Fatalf("login should set a cookie")
+	}
+	cookie := cookies[len(cookies)-1]
+	if cookie.Name != "__Host-sid" || cookie.Domain != "" ||
+		cookie.Path != "/" || !cookie.Secure || !cookie.HttpOnly ||
+		cookie.SameSite != http.SameSiteStrictMode {
+		t.Errorf("unexpected session cookie: %s", cookie)
+	}
+	request := httptest.NewRequest("GET", root+"/user", nil)
+	request.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	response = httptest.NewRecorder()
+	app.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("renamed cookie want: %d got: %d",
+			http.StatusOK, response.Code)
+	}
+	// The zero CookieOptions keep the cookie HttpOnly, unless scripts are
+	// explicitly allowed to read it.
+	for _, allow := range []bool{false, true} {
+		app := forest.New("")
+		wares.InstallSessionWares(app, manager, wares.WithCookie(
+			wares.CookieOptions{AllowScriptAccess: allow}))
+		app.RegisterRoute(root, &memoryRouter{app})
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, httptest.NewRequest("GET", root+"/login", nil))
+		cookies := (&http.Response{Header: response.Header()}).Cookies()
+		if len(cookies) == 0 {
+			t.Fatalf("login should set a cookie")
+		}
+		if cookie := cookies[len(cookies)-1]; cookie.HttpOnly == allow {
+			t.Errorf("AllowScriptAccess %v want HttpOnly: %v got: %s",
+				allow, !allow, cookie)
+		}
+	}
+}
+
+func TestSessionLimit(t *testing.T) {
+	for _, policy := range []wares.LimitPolicy{
+		wares.LimitReject, wares.LimitEvictOldest} {
+		manager := newMemoryManager()
+		defer manager.Close()
+		app := forest.New("")
+		wares.InstallSessionWares(app, manager, wares.WithSessionLimit(2, policy))
+		app.RegisterRoute(root, &memoryRouter{app})
+		first := login(t, app)
+		second := login(t, app)
+		// Storing an existing session again never counts against the limit.
+		params := &requested{auth: second, method: "GET", path: root + "/login"}
+		want := &wanted{code: http.StatusOK, success: true}
+		makeRequest(t, app, params, want)
+		params = &requested{method: "GET", path: root + "/login"}
+		if policy == wares.LimitReject {
+			want = &wanted{code: http.StatusConflict, success: false}
+			makeRequest(t, app, params, want)
+			if userID, _, _ := manager.Read(first); userID != sessionUserID {
+				t.Errorf("LimitReject should keep existing sessions")
+			}
+			continue
+		}
+		third := login(t, app)
+		if userID, _, _ := manager.Read(first); userID != "" {
+			t.Errorf("LimitEvictOldest should evict the oldest session")
+		}
+		for _, auth := range []string{second, third} {
+			if userID, _, _ := manager.Read(auth); userID != sessionUserID {
+				t.Errorf("LimitEvictOldest should keep newer sessions")
+			}
+		}
+	}
+}
+
+func TestSessionLimitRegenerate(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager,
+		wares.WithSessionLimit(1, wares.LimitReject))
+	app.RegisterRoute(root, &memoryRouter{app})
+	auth := login(t, app)
+	// Regenerating a session replaces it, so it does not count twice.
+	params := &requested{
+		auth: auth, method: "GET", path: root + "/login/regenerate"}
+	want := &wanted{code: http.StatusOK, success: true}
+	makeRequest(t, app, params, want)
+	params = &requested{method: "GET", path: root + "/login/regenerate"}
+	want = &wanted{code: http.StatusConflict, success: false}
+	makeRequest(t, app, params, want)
+	if sessions, _ := manager.ListSessions(sessionUserID); len(sessions) != 1 {
+		t.Errorf("SessionRegenerate should honor the limit, got: %d sessions",
+			len(sessions))
+	}
+}
+
+func TestSessionList(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager)
+	app.RegisterRoute(root, &memoryRouter{app})
+	params := &requested{method: "GET", path: root + "/sessions"}
+	want := &wanted{code: http.StatusUnauthorized, success: false}
+	makeRequest(t, app, params, want)
+	first, second := login(t, app), login(t, app)
+	params = &requested{auth: first, method: "GET", path: root + "/sessions"}
+	want = &wanted{code: http.StatusOK, success: true}
+	_, data := makeRequest(t, app, params, want)
+	items, _ := data.Data.([]interface{})
+	if len(items) != 2 {
+		t.Fatalf("SessionList want: 2 sessions got: %v", data.Data)
+	}
+	newest, oldest := items[0].(map[string]interface{}),
+		items[1].(map[string]interface{})
+	if newest["current"] != false || oldest["current"] != true {
+		t.Errorf("SessionList should list the newest session first")
+	}
+	for _, item := range items {
+		if id := item.(map[string]interface{})["id"]; id == first || id == second {
+			t.Errorf("SessionList should not expose session IDs")
+		}
+	}
+	params = &requested{auth: first, method: "DELETE",
+		path: root + "/sessions/" + newest["id"].(string)}
+	makeRequest(t, app, params, want)
+	if userID, _, _ := manager.Read(second); userID != "" {
+		t.Errorf("SessionDelByID should delete the session")
+	}
+	want = &wanted{code: http.StatusNotFound, success: false}
+	makeRequest(t, app, params, want)
+	// Listing requires a SessionLister.
+	app = forest.New("")
+	wares.InstallSessionWares(app, struct{ wares.SessionManager }{manager})
+	app.RegisterRoute(root, &memoryRouter{app})
+	params = &requested{auth: first, method: "GET", path: root + "/sessions"}
+	want = &wanted{code: http.StatusInternalServerError, success: false}
+	makeRequest(t, app, params, want)
+}
+
+func TestSessionMetadata(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	for _, opts := range [][]wares.Option{nil, {wares.WithClientIP(
+		func(request *http.Request) string {
+			return request.Header.Get("X-Forwarded-For")
+		})}} {
+		app := forest.New("")
+		wares.InstallSessionWares(app, manager, opts...)
+		app.RegisterRoute(root, &memoryRouter{app})
+		request := httptest.NewRequest("GET", root+"/login", nil)
+		request.Header.Set("User-Agent", "wares-test")
+		request.Header.Set("X-Forwarded-For", "198.51.100.1")
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		auth := sessionCookie(&http.Response{Header: response.Header()})
+		info, _ := manager.ReadInfo(auth)
+		want := "192.0.2.1"
+		if opts != nil {
+			want = "198.51.100.1"
+		}
+		if info == nil || info.IP != want || info.UserAgent != "wares-test" ||
+			info.LastSeen.IsZero() {
+			t.Errorf("SessionSet should record session metadata, got: %+v",
+				info)
+		}
+	}
+	// Addresses without a port are recorded as they are.
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager)
+	app.RegisterRoute(root, &memoryRouter{app})
+	request := httptest.NewRequest("GET", root+"/login", nil)
+	request.RemoteAddr = "@"
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, request)
+	auth := sessionCookie(&http.Response{Header: response.Header()})
+	if info, _ := manager.ReadInfo(auth); info == nil || info.IP != "@" {
+		t.Errorf("SessionSet should record RemoteAddr, got: %+v", info)
+	}
+}
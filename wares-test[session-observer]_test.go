@@ -0,0 +1,149 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ursiform/bear"
+	"github.com/ursiform/forest"
+	"github.com/ursiform/forest-wares"
+)
+
+type observedEvent struct {
+	event     wares.SessionEvent
+	sessionID string
+	userID    string
+}
+
+// implements SessionObserver
+type sessionObserver struct{ events []observedEvent }
+
+func (observer *sessionObserver) ObserveSession(event wares.SessionEvent,
+	sessionID string, userID string, ctx *bear.Context) {
+	observer.events = append(observer.events,
+		observedEvent{event, sessionID, userID})
+}
+
+// observe makes a request and returns the names of the events it caused.
+func (observer *sessionObserver) observe(t *testing.T, app *forest.App,
+	auth string, path string, code int) string {
+	observer.events = nil
+	params := &requested{auth: auth, method: "GET", path: root + path}
+	makeRequest(t, app, params, &wanted{code: code, success: code == 200})
+	names := make([]string, len(observer.events))
+	for i, event := range observer.events {
+		names[i] = event.event.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+func TestSessionObserver(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	observer := new(sessionObserver)
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager, wares.WithObserver(observer))
+	app.RegisterRoute(root, &memoryRouter{app})
+	auth := login(t, app)
+	tests := []struct {
+		path string
+		code int
+		want string
+	}{
+		{"/user", http.StatusOK, "resumed, refreshed"},
+		{"/revoke/others", http.StatusOK, "resumed, refreshed, revoked"},
+		{"/logout", http.StatusOK, "resumed, refreshed, deleted"},
+		{"/user", http.StatusUnauthorized, "invalid, created empty"}}
+	for _, test := range tests {
+		got := observer.observe(t, app, auth, test.path, test.code)
+		if got != test.want {
+			t.Errorf("%s want: %q got: %q", test.path, test.want, got)
+		}
+	}
+	want := "created empty, authenticated"
+	got := observer.observe(t, app, "", "/login/regenerate", http.StatusOK)
+	if got != want {
+		t.Errorf("/login/regenerate want: %q got: %q", want, got)
+	}
+	authenticated := observer.events[1]
+	if authenticated.userID != sessionUserID ||
+		authenticated.sessionID == observer.events[0].sessionID {
+		t.Errorf("SessionRegenerate should observe the regenerated session")
+	}
+	if got = observer.observe(t, app, authenticated.sessionID,
+		"/revoke", http.StatusOK); got != "resumed, refreshed, revoked" {
+		t.Errorf("/revoke got: %q", got)
+	}
+	if event := observer.events[2]; event.sessionID !=
+		authenticated.sessionID || event.userID != sessionUserID {
+		t.Errorf("SessionRevoke observed: %+v", event)
+	}
+}
+
+func TestSessionObserverExpiry(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	observer := new(sessionObserver)
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager,
+		wares.WithAbsoluteTimeout(10*time.Millisecond),
+		wares.WithObserver(observer))
+	app.RegisterRoute(root, &memoryRouter{app})
+	auth := login(t, app)
+	time.Sleep(20 * time.Millisecond)
+	want := "expired, created empty"
+	if got := observer.observe(t, app, auth, "/user",
+		http.StatusUnauthorized); got != want {
+		t.Errorf("/user want: %q got: %q", want, got)
+	}
+	if event := observer.events[0]; event.sessionID != auth ||
+		event.userID != sessionUserID {
+		t.Errorf("SessionExpired observed: %+v", event)
+	}
+}
+
+func TestCookieSessionObserver(t *testing.T) {
+	manager, err := wares.NewSignedCookieSessionManager(&wares.CookieConfig{
+		Keys:    wares.Keyring{Current: cookieKeyCurrent},
+		NewUser: func() interface{} { return new(memoryUser) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	observer := wares.SessionObserverFunc(func(event wares.SessionEvent,
+		sessionID string, userID string, ctx *bear.Context) {
+		names = append(names, event.String())
+	})
+	app := forest.New("")
+	wares.InstallCookieSessionWares(app, manager, wares.WithObserver(observer))
+	app.RegisterRoute(root, &memoryRouter{app})
+	auth := login(t, app)
+	tests := []struct {
+		auth string
+		path string
+		code int
+		want string
+	}{
+		{auth, "/user", http.StatusOK, "resumed, refreshed"},
+		{auth, "/logout", http.StatusOK, "resumed, refreshed, deleted"},
+		{"forged", "/user", http.StatusUnauthorized, "invalid, created empty"}}
+	for _, test := range tests {
+		names = nil
+		params := &requested{auth: test.auth, method: "GET",
+			path: root + test.path}
+		want := &wanted{code: test.code, success: test.code == http.StatusOK}
+		makeRequest(t, app, params, want)
+		if got := strings.Join(names, ", "); got != test.want {
+			t.Errorf("%s want: %q got: %q", test.path, test.want, got)
+		}
+	}
+	if name := wares.SessionEvent(-1).String(); name != "unknown" {
+		t.Errorf("SessionEvent(-1) want: unknown got: %s", name)
+	}
+}
@@ -0,0 +1,522 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ursiform/forest-wares"
+)
+
+// sqlDriver is an in-process database/sql driver that understands exactly
+// the statements issued by SQLSessionManager. Each DSN is its own database,
+// which rejects the statements its dialect would, such as a column that does
+// not exist or MySQL's lack of "CREATE INDEX IF NOT EXISTS". A transaction
+// rolls back the schema, but not the sessions, as of when it began.
+type sqlDriver struct {
+	databases map[string]*sqlDatabase
+	mutex     sync.Mutex
+}
+
+type sqlDatabase struct {
+	columns map[string]bool
+	failing bool
+	// failingIndex makes creating an index fail.
+	failingIndex bool
+	indexed      bool
+	mutex        sync.Mutex
+	mysql        bool
+	rows         map[string]*sqlRow
+	versions     []int64
+}
+
+type sqlRow struct {
+	created     int64
+	expires     int64
+	fingerprint string
+	ip          string
+	lastSeen    int64
+	userAgent   string
+	userID      string
+	userJSON    string
+}
+
+type sqlConn struct{ database *sqlDatabase }
+type sqlResult int64
+type sqlRows struct {
+	columns []string
+	values  [][]driver.Value
+	index   int
+}
+type sqlStmt struct {
+	conn  *sqlConn
+	query string
+}
+type sqlTx struct {
+	columns  map[string]bool
+	database *sqlDatabase
+	indexed  bool
+	versions []int64
+}
+
+var sqlTestDriver = &sqlDriver{databases: make(map[string]*sqlDatabase)}
+
+func init() { sql.Register("wares-test", sqlTestDriver) }
+
+func (d *sqlDriver) Open(name string) (driver.Conn, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.databases[name] == nil {
+		d.databases[name] = &sqlDatabase{rows: make(map[string]*sqlRow)}
+	}
+	return &sqlConn{database: d.databases[name]}, nil
+}
+
+func (conn *sqlConn) Begin() (driver.Tx, error) {
+	database := conn.database
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	return &sqlTx{
+		columns:  database.columns,
+		database: database,
+		indexed:  database.indexed,
+		versions: database.versions}, nil
+}
+func (conn *sqlConn) Close() error { return nil }
+func (conn *sqlConn) Prepare(query string) (driver.Stmt, error) {
+	return &sqlStmt{conn: conn, query: query}, nil
+}
+
+func (result sqlResult) LastInsertId() (int64, error) { return 0, nil }
+func (result sqlResult) RowsAffected() (int64, error) { return int64(result), nil }
+
+func (rows *sqlRows) Close() error      { return nil }
+func (rows *sqlRows) Columns() []string { return rows.columns }
+func (rows *sqlRows) Next(dest []driver.Value) error {
+	if rows.index >= len(rows.values) {
+		return io.EOF
+	}
+	copy(dest, rows.values[rows.index])
+	rows.index++
+	return nil
+}
+
+func (stmt *sqlStmt) Close() error  { return nil }
+func (stmt *sqlStmt) NumInput() int { return -1 }
+func (stmt *sqlStmt) Exec(args []driver.Value) (driver.Result, error) {
+	database := stmt.conn.database
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	if database.failing {
+		return nil, errors.New("sqlDriver: database is failing")
+	}
+	affected := 0
+	switch query := stmt.query; {
+	case strings.Contains(query, "_schema"):
+		if strings.HasPrefix(query, "INSERT") {
+			database.versions = append(database.versions, args[0].(int64))
+		}
+	case strings.HasPrefix(query, "CREATE TABLE"):
+		if database.columns != nil {
+			break
+		}
+		database.columns = make(map[string]bool)
+		definitions := query[strings.Index(query, "(")+1 : len(query)-1]
+		for _, definition := range strings.Split(definitions, ", ") {
+			name := strings.Fields(definition)[0]
+			database.columns[name] = true
+			database.indexed = database.indexed || name == "INDEX"
+		}
+	case strings.HasPrefix(query, "CREATE INDEX"):
+		if database.mysql {
+			return nil, errors.New("sqlDriver: syntax error: " + query)
+		}
+		if database.failingIndex {
+			return nil, errors.New("sqlDriver: index is failing")
+		}
+		database.indexed = true
+	case strings.HasPrefix(query, "INSERT"):
+		if !database.columns["fingerprint"] {
+			return nil, errors.New("sqlDriver: no such column: fingerprint")
+		}
+		if database.mysql != strings.Contains(query, "ON DUPLICATE KEY") {
+			return nil, errors.New("sqlDriver: syntax error: " + query)
+		}
+		row, ok := database.rows[args[0].(string)]
+		if !ok {
+			row = &sqlRow{
+				created:     args[4].(int64),
+				ip:          args[5].(string),
+				userAgent:   args[6].(string),
+				lastSeen:    args[7].(int64),
+				fingerprint: args[8].(string)}
+			database.rows[args[0].(string)] = row
+		}
+		row.userID = args[1].(string)
+		row.userJSON = args[2].(string)
+		row.expires = args[3].(int64)
+		affected = 1
+	case strings.Contains(query, "SET fingerprint"):
+		row, ok := database.rows[args[1].(string)]
+		if ok && row.fingerprint == "" {
+			row.fingerprint = args[0].(string)
+			affected = 1
+		}
+	case strings.Contains(query, "SET ip"):
+		if row, ok := database.rows[args[3].(string)]; ok {
+			row.ip = args[0].(string)
+			row.userAgent = args[1].(string)
+			row.lastSeen = args[2].(int64)
+			affected = 1
+		}
+	case strings.Contains(query, "WHERE session_id"):
+		if _, ok := database.rows[args[0].(string)]; ok {
+			delete(database.rows, args[0].(string))
+			affected = 1
+		}
+	case strings.Contains(query, "WHERE user_id"):
+		for sessionID, row := range database.rows {
+			if row.userID == args[0].(string) {
+				delete(database.rows, sessionID)
+				affected++
+			}
+		}
+	case strings.Contains(query, "WHERE expires_at"):
+		for sessionID, row := range database.rows {
+			if row.expires <= args[0].(int64) {
+				delete(database.rows, sessionID)
+				affected++
+			}
+		}
+	default:
+		return nil, errors.New("sqlDriver: unknown statement: " + query)
+	}
+	return sqlResult(affected), nil
+}
+func (stmt *sqlStmt) Query(args []driver.Value) (driver.Rows, error) {
+	database := stmt.conn.database
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	if database.failing {
+		return nil, errors.New("sqlDriver: database is failing")
+	}
+	rows := new(sqlRows)
+	if strings.Contains(stmt.query, "MAX(version)") {
+		rows.columns = []string{"version"}
+		var version driver.Value
+		for _, recorded := range database.versions {
+			if version == nil || recorded > version.(int64) {
+				version = recorded
+			}
+		}
+		rows.values = [][]driver.Value{{version}}
+		return rows, nil
+	}
+	if strings.Contains(stmt.query, "WHERE user_id") {
+		rows.columns = []string{"session_id", "user_id", "user_json",
+			"created_at", "expires_at", "ip", "user_agent", "last_seen",
+			"fingerprint"}
+		for sessionID, row := range database.rows {
+			if row.userID == args[0].(string) && row.expires > args[1].(int64) {
+				rows.values = append(rows.values, []driver.Value{sessionID,
+					row.userID, row.userJSON, row.created, row.expires,
+					row.ip, row.userAgent, row.lastSeen, row.fingerprint})
+			}
+		}
+		return rows, nil
+	}
+	rows.columns = []string{"user_id", "user_json", "created_at",
+		"expires_at", "ip", "user_agent", "last_seen", "fingerprint"}
+	row, ok := database.rows[args[0].(string)]
+	if ok && row.expires > args[1].(int64) {
+		rows.values = append(rows.values, []driver.Value{
+			row.userID, row.userJSON, row.created, row.expires,
+			row.ip, row.userAgent, row.lastSeen, row.fingerprint})
+	}
+	return rows, nil
+}
+
+func (tx *sqlTx) Commit() error { return nil }
+func (tx *sqlTx) Rollback() error {
+	tx.database.mutex.Lock()
+	defer tx.database.mutex.Unlock()
+	tx.database.columns = tx.columns
+	tx.database.indexed = tx.indexed
+	tx.database.versions = tx.versions
+	return nil
+}
+
+func newSQLManager(t *testing.T,
+	config *wares.SQLConfig) (*wares.SQLSessionManager, *sqlDatabase) {
+	db, err := sql.Open("wares-test", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	config.DB = db
+	manager, err := wares.NewSQLSessionManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { manager.Close() })
+	database, _ := sqlTestDriver.Open(t.Name())
+	return manager, database.(*sqlConn).database
+}
+
+func TestSQLSessionManagerConfigError(t *testing.T) {
+	if _, err := wares.NewSQLSessionManager(nil); err == nil {
+		t.Errorf("NewSQLSessionManager should fail without DB")
+	}
+	db, _ := sql.Open("wares-test", t.Name())
+	defer db.Close()
+	config := &wares.SQLConfig{DB: db, Table: "sessions; DROP TABLE users"}
+	if _, err := wares.NewSQLSessionManager(config); err == nil {
+		t.Errorf("NewSQLSessionManager should reject invalid table names")
+	}
+}
+
+func TestSQLSessionManagerContext(t *testing.T) {
+	manager, _ := newSQLManager(t, new(wares.SQLConfig))
+	if wares.NewContextSessionManager(manager) != manager {
+		t.Errorf("SQLSessionManager should be a ContextSessionManager")
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := manager.ReadContext(cancelled, sessionIDExistent); err == nil {
+		t.Errorf("ReadContext should fail once the context is done")
+	}
+	manager.Migrate()
+	err := manager.UpdateContext(cancelled, sessionIDExistent, sessionUserID,
+		sessionUserJSON, time.Hour)
+	if err == nil {
+		t.Errorf("UpdateContext should fail once the context is done")
+	}
+	_, err = manager.ReadInfoContext(cancelled, sessionIDExistent)
+	if err == nil {
+		t.Errorf("ReadInfoContext should fail once the context is done")
+	}
+	if err := manager.RevokeContext(cancelled, sessionUserID); err == nil {
+		t.Errorf("RevokeContext should fail once the context is done")
+	}
+	if err := manager.DeleteContext(cancelled, sessionIDExistent,
+		sessionUserID); err == nil {
+		t.Errorf("DeleteContext should fail once the context is done")
+	}
+}
+
+func TestSQLSessionManagerFailure(t *testing.T) {
+	manager, database := newSQLManager(t, new(wares.SQLConfig))
+	database.failing = true
+	if err := manager.Migrate(); err == nil {
+		t.Errorf("Migrate should propagate database errors")
+	}
+	if _, _, err := manager.Read(sessionIDExistent); err == nil {
+		t.Errorf("Read should propagate database errors")
+	}
+	if err := manager.Delete(sessionIDExistent, sessionUserID); err == nil {
+		t.Errorf("Delete should propagate database errors")
+	}
+	if err := manager.Revoke(sessionUserID); err == nil {
+		t.Errorf("Revoke should propagate database errors")
+	}
+	if _, err := manager.ListSessions(sessionUserID); err == nil {
+		t.Errorf("ListSessions should propagate database errors")
+	}
+	if _, err := manager.Purge(); err == nil {
+		t.Errorf("Purge should propagate database errors")
+	}
+	if err := manager.Touch(sessionIDExistent, "", ""); err == nil {
+		t.Errorf("Touch should propagate database errors")
+	}
+	if err := manager.SetFingerprint(sessionIDExistent, ""); err == nil {
+		t.Errorf("SetFingerprint should propagate database errors")
+	}
+	err := manager.Update(sessionIDExistent, sessionUserID,
+		sessionUserJSON, time.Hour)
+	if err == nil {
+		t.Errorf("Update should propagate database errors")
+	}
+	database.failing = false
+	manager.Migrate()
+	database.failing = true
+	if _, err := manager.ListSessions(sessionUserID); err == nil {
+		t.Errorf("ListSessions should propagate database errors")
+	}
+	if _, _, err := manager.Read(sessionIDExistent); err == nil {
+		t.Errorf("Read should propagate database errors")
+	}
+	if _, err := manager.Purge(); err == nil {
+		t.Errorf("Purge should propagate database errors")
+	}
+	err = manager.Update(sessionIDExistent, sessionUserID,
+		sessionUserJSON, time.Hour)
+	if err == nil {
+		t.Errorf("Update should propagate database errors")
+	}
+}
+
+func TestSQLSessionManagerLifecycle(t *testing.T) {
+	manager, database := newSQLManager(t,
+		&wares.SQLConfig{Placeholder: wares.DollarPlaceholder})
+	if userID, _, err := manager.Read(sessionIDNonExistent); err != nil ||
+		userID != "" {
+		t.Errorf("Read of nonexistent session should be empty (%v)", err)
+	}
+	if len(database.columns) != 9 || !database.indexed {
+		t.Errorf("Migrate should create a table and an index")
+	}
+	if len(database.versions) != 1 || database.versions[0] != 1 {
+		t.Errorf("Migrate should record the schema version, got: %v",
+			database.versions)
+	}
+	manager.Update(sessionIDExistent, sessionUserID, sessionUserJSON, time.Hour)
+	created := database.rows[sessionIDExistent].created
+	manager.Update(sessionIDExistent, sessionUserID, sessionUserJSON, time.Hour)
+	if database.rows[sessionIDExistent].created != created {
+		t.Errorf("Update should not change created_at")
+	}
+	if len(database.versions) != 1 {
+		t.Errorf("Migrate should only run once")
+	}
+	info, err := manager.ReadInfo(sessionIDExistent)
+	if err != nil || info == nil || info.Created.UnixNano() != created {
+		t.Errorf("ReadInfo should return the session creation time")
+	}
+	if !info.LastSeen.IsZero() {
+		t.Errorf("LastSeen should be zero until the session is touched")
+	}
+	if err := manager.Touch(sessionIDExistent, "192.0.2.1", "agent"); err != nil {
+		t.Error(err)
+	}
+	manager.Update(sessionIDExistent, sessionUserID, sessionUserJSON, time.Hour)
+	info, _ = manager.ReadInfo(sessionIDExistent)
+	if info.IP != "192.0.2.1" || info.UserAgent != "agent" ||
+		info.LastSeen.IsZero() {
+		t.Errorf("Touch should record session metadata, got: %+v", info)
+	}
+	manager.SetFingerprint(sessionIDExistent, "first")
+	manager.SetFingerprint(sessionIDExistent, "second")
+	if info, _ = manager.ReadInfo(sessionIDExistent); info.Fingerprint != "first" {
+		t.Errorf("SetFingerprint should not rebind a session, got: %s",
+			info.Fingerprint)
+	}
+	userID, userJSON, err := manager.Read(sessionIDExistent)
+	if err != nil || userID != sessionUserID || userJSON != sessionUserJSON {
+		t.Errorf("Read want: %s %s got: %s %s (%v)",
+			sessionUserID, sessionUserJSON, userID, userJSON, err)
+	}
+	if err := manager.Delete(sessionIDExistent, sessionUserID); err != nil {
+		t.Error(err)
+	}
+	if userID, _, _ := manager.Read(sessionIDExistent); userID != "" {
+		t.Errorf("Read should not return deleted session, got: %s", userID)
+	}
+	manager.Update(sessionIDExistent, sessionUserID, sessionUserJSON, time.Hour)
+	manager.Update(sessionIDExistent, sessionUserID, sessionUserJSON, 0)
+	if userID, _, _ := manager.Read(sessionIDExistent); userID != "" {
+		t.Errorf("Read should not return expired session, got: %s", userID)
+	}
+}
+
+func TestSQLSessionManagerPurge(t *testing.T) {
+	manager, database := newSQLManager(t,
+		&wares.SQLConfig{PurgeInterval: 5 * time.Millisecond})
+	manager.Update("A", sessionUserID, sessionUserJSON, time.Millisecond)
+	manager.Update("B", sessionUserID, sessionUserJSON, time.Hour)
+	time.Sleep(20 * time.Millisecond)
+	if userID, _, _ := manager.Read("A"); userID != "" {
+		t.Errorf("Read should not return expired session, got: %s", userID)
+	}
+	database.mutex.Lock()
+	if _, ok := database.rows["A"]; ok {
+		t.Errorf("expired session should be purged")
+	}
+	database.mutex.Unlock()
+	manager.Update("C", sessionUserID, sessionUserJSON, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if purged, err := manager.Purge(); err != nil || purged > 1 {
+		t.Errorf("Purge want: at most 1 got: %d (%v)", purged, err)
+	}
+}
+
+func TestSQLSessionManagerRevoke(t *testing.T) {
+	manager, _ := newSQLManager(t, &wares.SQLConfig{Table: "user_sessions"})
+	manager.Update("A", sessionUserID, sessionUserJSON, time.Hour)
+	manager.Update("B", sessionUserID, sessionUserJSON, time.Hour)
+	manager.Update("C", "OTHER-USER-ID", arbitraryJSON, time.Hour)
+	sessions, err := manager.ListSessions(sessionUserID)
+	if err != nil || len(sessions) != 2 {
+		t.Errorf("ListSessions want: 2 sessions got: %d (%v)",
+			len(sessions), err)
+	}
+	if err := manager.Revoke(sessionUserID); err != nil {
+		t.Fatal(err)
+	}
+	for _, sessionID := range []string{"A", "B"} {
+		if userID, _, _ := manager.Read(sessionID); userID != "" {
+			t.Errorf("Revoke should delete session %s", sessionID)
+		}
+	}
+	if userID, _, _ := manager.Read("C"); userID != "OTHER-USER-ID" {
+		t.Errorf("Revoke should not delete other users' sessions")
+	}
+}
+
+func TestSQLSessionManagerMySQL(t *testing.T) {
+	manager, database := newSQLManager(t,
+		&wares.SQLConfig{Dialect: wares.DialectMySQL})
+	database.mysql = true
+	if err := manager.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if !database.indexed {
+		t.Errorf("Migrate should create an index on MySQL")
+	}
+	manager.Update(sessionIDExistent, sessionUserID, sessionUserJSON, time.Hour)
+	created := database.rows[sessionIDExistent].created
+	err := manager.Update(sessionIDExistent, sessionUserID, arbitraryJSON,
+		time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row := database.rows[sessionIDExistent]; row.created != created ||
+		row.userJSON != arbitraryJSON {
+		t.Errorf("Update should upsert an existing session")
+	}
+}
+
+func TestSQLSessionManagerMigrateRollback(t *testing.T) {
+	manager, database := newSQLManager(t, new(wares.SQLConfig))
+	// A step that fails part of the way through is rolled back whole.
+	database.failingIndex = true
+	if err := manager.Migrate(); err == nil {
+		t.Errorf("Migrate should propagate a failed step")
+	}
+	if database.columns != nil || len(database.versions) != 0 {
+		t.Errorf("a failed step should be rolled back, got: %v, %v",
+			database.columns, database.versions)
+	}
+	// It is retried on the next operation.
+	database.failingIndex = false
+	if err := manager.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if !database.indexed || len(database.versions) != 1 {
+		t.Errorf("Migrate should retry a failed step")
+	}
+	// A table that is already current is left as is.
+	current, _ := newSQLManager(t, new(wares.SQLConfig))
+	if err := current.Migrate(); err != nil || len(database.versions) != 1 {
+		t.Errorf("Migrate should not upgrade a current table again (%v)", err)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ursiform/forest"
+	"github.com/ursiform/forest-wares"
+)
+
+const tenantHeader = "X-Tenant"
+
+// tenantRequest makes a request on behalf of tenant, sending auth in the
+// tenant's session cookie, and returns the response along with the value of
+// the last session cookie it sets, if any.
+func tenantRequest(app *forest.App, tenant string, auth string,
+	path string) (*httptest.ResponseRecorder, string) {
+	name := forest.SessionID + "_" + tenant
+	request := httptest.NewRequest("GET", root+path, nil)
+	request.Header.Set(tenantHeader, tenant)
+	if auth != "" {
+		request.AddCookie(&http.Cookie{Name: name, Value: auth})
+	}
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, request)
+	value := ""
+	for _, cookie := range (&http.Response{
+		Header: response.Header()}).Cookies() {
+		if cookie.Name == name {
+			value = cookie.Value
+		}
+	}
+	return response, value
+}
+
+func TestTenantResolvers(t *testing.T) {
+	request := httptest.NewRequest("GET", "http://Example.com:8080/acme/x", nil)
+	request.Header.Set(tenantHeader, "initech")
+	tests := []struct {
+		name    string
+		resolve wares.TenantResolver
+		want    string
+	}{
+		{"HeaderTenant", wares.HeaderTenant(tenantHeader), "initech"},
+		{"HostTenant", wares.HostTenant(), "example.com"},
+		{"PathPrefixTenant", wares.PathPrefixTenant(), "acme"}}
+	for _, test := range tests {
+		if tenant := test.resolve(request); tenant != test.want {
+			t.Errorf("%s want: %s got: %s", test.name, test.want, tenant)
+		}
+	}
+	request = httptest.NewRequest("GET", "http://example.com/", nil)
+	if tenant := wares.HostTenant()(request); tenant != "example.com" {
+		t.Errorf("HostTenant without a port want: example.com got: %s", tenant)
+	}
+	if tenant := wares.PathPrefixTenant()(request); tenant != "" {
+		t.Errorf("PathPrefixTenant of / want: empty got: %s", tenant)
+	}
+}
+
+func TestSessionTenants(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager,
+		wares.WithTenants(wares.HeaderTenant(tenantHeader)))
+	app.RegisterRoute(root, &memoryRouter{app})
+	_, acme := tenantRequest(app, "acme", "", "/login")
+	if acme == "" {
+		t.Fatalf("SessionSet should set the tenant's session cookie")
+	}
+	if response, _ := tenantRequest(app, "acme", acme,
+		"/user"); response.Code != http.StatusOK {
+		t.Errorf("a session should be honored by its tenant, got: %d",
+			response.Code)
+	}
+	// Tenants are escaped, so "acme" and "acme:x" share no keys.
+	for _, tenant := range []string{"globex", "acme:x"} {
+		if response, _ := tenantRequest(app, tenant, acme,
+			"/user"); response.Code != http.StatusUnauthorized {
+			t.Errorf("a session should not be honored by %s, got: %d",
+				tenant, response.Code)
+		}
+	}
+	// Sessions and users are stored under the tenant's keys.
+	if userID, _, _ := manager.Read(acme); userID != "" {
+		t.Errorf("a session should not be stored under its bare ID")
+	}
+	if userID, _, _ := manager.Read("acme:" + acme); userID !=
+		"acme:"+sessionUserID {
+		t.Errorf("userID want: acme:%s got: %s", sessionUserID, userID)
+	}
+	// Revoking a user's sessions in one tenant leaves the others intact.
+	_, globex := tenantRequest(app, "globex", "", "/login")
+	tenantRequest(app, "globex", globex, "/revoke")
+	if response, _ := tenantRequest(app, "globex", globex,
+		"/user"); response.Code != http.StatusUnauthorized {
+		t.Errorf("SessionRevoke should revoke the tenant's sessions")
+	}
+	response, _ := tenantRequest(app, "acme", acme, "/sessions")
+	if response.Code != http.StatusOK {
+		t.Fatalf("/sessions want: 200 got: %d", response.Code)
+	}
+	listed := new(struct{ Data []map[string]interface{} })
+	json.Unmarshal(response.Body.Bytes(), listed)
+	if len(listed.Data) != 1 {
+		t.Errorf("SessionList want: 1 session got: %d", len(listed.Data))
+	}
+}
+
+func TestSessionTenantsExtractors(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager,
+		wares.WithTenants(wares.HeaderTenant(tenantHeader)),
+		wares.WithExtractors(wares.BearerExtractor(),
+			wares.SessionCookieExtractor()))
+	app.RegisterRoute(root, &memoryRouter{app})
+	// The session cookie is read under the tenant's cookie name.
+	_, acme := tenantRequest(app, "acme", "", "/login")
+	if response, _ := tenantRequest(app, "acme", acme,
+		"/user"); response.Code != http.StatusOK {
+		t.Errorf("a tenant's session cookie should be extracted, got: %d",
+			response.Code)
+	}
+}
+
+func TestSessionTenantsExtensions(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	app := forest.New("")
+	// The manager does not implement SessionLister, so the session limit
+	// cannot be enforced and logins proceed.
+	wares.InstallSessionWares(app, plainManager{manager},
+		wares.WithTenants(wares.HeaderTenant(tenantHeader)),
+		wares.WithSessionLimit(1, wares.LimitReject))
+	app.RegisterRoute(root, &memoryRouter{app})
+	for i := 0; i < 2; i++ {
+		if response, _ := tenantRequest(app, "acme", "",
+			"/login"); response.Code != http.StatusOK {
+			t.Errorf("login without a SessionLister want: 200 got: %d",
+				response.Code)
+		}
+	}
+}
+
+func TestCookieSessionTenants(t *testing.T) {
+	manager, err := wares.NewSignedCookieSessionManager(&wares.CookieConfig{
+		Keys:    wares.Keyring{Current: cookieKeyCurrent},
+		NewUser: func() interface{} { return new(memoryUser) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := forest.New("")
+	wares.InstallCookieSessionWares(app, manager,
+		wares.WithTenants(wares.HeaderTenant(tenantHeader)))
+	app.RegisterRoute(root, &memoryRouter{app})
+	_, acme := tenantRequest(app, "acme", "", "/login")
+	response, refreshed := tenantRequest(app, "acme", acme, "/user")
+	if response.Code != http.StatusOK {
+		t.Errorf("a session should be honored by its tenant, got: %d",
+			response.Code)
+	}
+	if response, _ = tenantRequest(app, "acme", refreshed,
+		"/user"); response.Code != http.StatusOK {
+		t.Errorf("a refreshed session should be honored, got: %d",
+			response.Code)
+	}
+	if response, _ = tenantRequest(app, "globex", acme,
+		"/user"); response.Code != http.StatusUnauthorized {
+		t.Errorf("a session should not be honored by another tenant, got: %d",
+			response.Code)
+	}
+	_, anonymous := tenantRequest(app, "acme", "", "/user")
+	if response, _ = tenantRequest(app, "globex", anonymous,
+		"/user"); response.Code != http.StatusUnauthorized {
+		t.Errorf("an anonymous session should not cross tenants")
+	}
+}
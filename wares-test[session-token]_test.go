@@ -0,0 +1,129 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ursiform/forest"
+	"github.com/ursiform/forest-wares"
+)
+
+func TestTokenExtractors(t *testing.T) {
+	request := httptest.NewRequest("GET", "/?session=query-token", nil)
+	request.Header.Set("Authorization", "bearer  bearer-token ")
+	request.Header.Set("X-Session", "header-token")
+	request.AddCookie(&http.Cookie{Name: "sid", Value: "cookie-token"})
+	tests := []struct {
+		extractor wares.TokenExtractor
+		want      string
+	}{
+		{wares.BearerExtractor(), "bearer-token"},
+		{wares.CookieExtractor("sid"), "cookie-token"},
+		{wares.CookieExtractor("missing"), ""},
+		{wares.SessionCookieExtractor(), "cookie-token"},
+		{wares.HeaderExtractor("X-Session"), "header-token"},
+		{wares.QueryExtractor("session"), "query-token"}}
+	for _, test := range tests {
+		if token := test.extractor(request, "sid"); token != test.want {
+			t.Errorf("extractor want: %q got: %q", test.want, token)
+		}
+	}
+	for _, header := range []string{"", "Bear", "Basic dXNlcjpwYXNz"} {
+		request.Header.Set("Authorization", header)
+		if token := wares.BearerExtractor()(request, ""); token != "" {
+			t.Errorf("BearerExtractor(%q) should be empty, got: %q",
+				header, token)
+		}
+	}
+}
+
+func TestSessionExtractors(t *testing.T) {
+	manager := newMemoryManager()
+	defer manager.Close()
+	app := forest.New("")
+	wares.InstallSessionWares(app, manager, wares.WithExtractors(
+		wares.BearerExtractor(),
+		wares.HeaderExtractor("X-Session"),
+		wares.QueryExtractor("session"),
+		wares.SessionCookieExtractor()))
+	app.RegisterRoute(root, &memoryRouter{app})
+	auth := login(t, app)
+	requests := map[string]*http.Request{
+		"bearer": httptest.NewRequest("GET", root+"/user", nil),
+		"header": httptest.NewRequest("GET", root+"/user", nil),
+		"query":  httptest.NewRequest("GET", root+"/user?session="+auth, nil),
+		"cookie": httptest.NewRequest("GET", root+"/user", nil)}
+	requests["bearer"].Header.Set("Authorization", "Bearer "+auth)
+	requests["header"].Header.Set("X-Session", auth)
+	requests["cookie"].AddCookie(
+		&http.Cookie{Name: forest.SessionID, Value: auth})
+	for source, request := range requests {
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		if response.Code != http.StatusOK {
+			t.Errorf("%s token want: %d got: %d",
+				source, http.StatusOK, response.Code)
+		}
+		// Only a token from the session cookie is written back to it.
+		cookie := response.Header().Get("Set-Cookie")
+		if source == "cookie" && cookie == "" {
+			t.Errorf("cookie token should refresh the session cookie")
+		} else if source != "cookie" && cookie != "" {
+			t.Errorf("%s token should not set a cookie, got: %s",
+				source, cookie)
+		}
+	}
+	// Nor does a token that is not honored get replaced by a cookie.
+	request := httptest.NewRequest("GET", root+"/user", nil)
+	request.Header.Set("Authorization", "Bearer "+sessionIDNonExistent)
+	response := httptest.NewRecorder()
+	app.ServeHTTP(response, request)
+	if cookie := response.Header().Get("Set-Cookie"); cookie != "" {
+		t.Errorf("invalid bearer token should not set a cookie, got: %s",
+			cookie)
+	}
+	// Earlier extractors take precedence over later ones.
+	request = httptest.NewRequest("GET", root+"/user", nil)
+	request.Header.Set("Authorization", "Bearer "+sessionIDNonExistent)
+	request.AddCookie(&http.Cookie{Name: forest.SessionID, Value: auth})
+	response = httptest.NewRecorder()
+	app.ServeHTTP(response, request)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("bearer token should take precedence over cookie")
+	}
+}
+
+func TestCookieSessionExtractors(t *testing.T) {
+	manager, err := wares.NewSignedCookieSessionManager(&wares.CookieConfig{
+		Keys:    wares.Keyring{Current: cookieKeyCurrent},
+		NewUser: func() interface{} { return new(memoryUser) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := forest.New("")
+	wares.InstallCookieSessionWares(app, manager,
+		wares.WithExtractors(wares.QueryExtractor("session")))
+	app.RegisterRoute(root, &memoryRouter{app})
+	value, _ := manager.Encode(sessionIDExistent, sessionUserID,
+		sessionUserJSON, time.Hour)
+	for _, token := range []string{value, "forged"} {
+		request := httptest.NewRequest("GET",
+			root+"/user?session="+url.QueryEscape(token), nil)
+		response := httptest.NewRecorder()
+		app.ServeHTTP(response, request)
+		if token == value && response.Code != http.StatusOK {
+			t.Errorf("query token want: %d got: %d",
+				http.StatusOK, response.Code)
+		}
+		if cookie := response.Header().Get("Set-Cookie"); cookie != "" {
+			t.Errorf("query token should not set a cookie, got: %s", cookie)
+		}
+	}
+}
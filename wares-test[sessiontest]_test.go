@@ -0,0 +1,110 @@
+// Copyright 2015 Afshin Darian. All rights reserved.
+// Use of this source code is governed by The MIT License
+// that can be found in the LICENSE file.
+
+package wares_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ursiform/forest-wares"
+	"github.com/ursiform/forest-wares/sessiontest"
+)
+
+var errFailingManager = errors.New("failingManager: store is unreachable")
+
+// implements SessionManager
+type failingManager struct{ wares.SessionBinder }
+
+func (manager failingManager) Delete(sessionID string, userID string) error {
+	return errFailingManager
+}
+func (manager failingManager) Read(sessionID string) (userID string,
+	userJSON string, err error) {
+	return "", "", errFailingManager
+}
+func (manager failingManager) Revoke(userID string) error {
+	return errFailingManager
+}
+func (manager failingManager) Update(sessionID string, userID string,
+	userJSON string, duration time.Duration) error {
+	return errFailingManager
+}
+
+func TestSessionManagerConformance(t *testing.T) {
+	clock := wares.NewFakeClock(time.Now())
+	newMemory := func(t *testing.T) wares.SessionManager {
+		manager := wares.NewMemorySessionManager(&wares.MemoryConfig{
+			Clock:   clock,
+			NewUser: func() interface{} { return new(memoryUser) }})
+		t.Cleanup(func() { manager.Close() })
+		return manager
+	}
+	failing := func(t *testing.T) wares.SessionManager {
+		return failingManager{}
+	}
+	t.Run("Memory", func(t *testing.T) {
+		sessiontest.Run(t, sessiontest.Config{
+			Advance: clock.Advance,
+			Failing: failing,
+			New:     newMemory})
+	})
+	t.Run("File", func(t *testing.T) {
+		sessiontest.Run(t, sessiontest.Config{
+			Advance: clock.Advance,
+			New: func(t *testing.T) wares.SessionManager {
+				manager, err := wares.NewFileSessionManager(
+					&wares.FileConfig{Clock: clock, Dir: t.TempDir()})
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { manager.Close() })
+				return manager
+			}})
+	})
+	t.Run("SQL", func(t *testing.T) {
+		sessiontest.Run(t, sessiontest.Config{
+			Advance: clock.Advance,
+			Failing: func(t *testing.T) wares.SessionManager {
+				manager, database := newSQLManager(t, new(wares.SQLConfig))
+				database.failing = true
+				return manager
+			},
+			New: func(t *testing.T) wares.SessionManager {
+				manager, _ := newSQLManager(t, &wares.SQLConfig{Clock: clock})
+				return manager
+			}})
+	})
+	t.Run("Cached", func(t *testing.T) {
+		sessiontest.Run(t, sessiontest.Config{
+			Advance: clock.Advance,
+			Failing: func(t *testing.T) wares.SessionManager {
+				return wares.NewCachedSessionManager(failingManager{}, nil)
+			},
+			New: func(t *testing.T) wares.SessionManager {
+				return wares.NewCachedSessionManager(newMemory(t),
+					&wares.CacheConfig{Clock: clock})
+			}})
+	})
+	// The cache implements every optional extension, but only supports
+	// those of the manager it wraps.
+	t.Run("CachedPlain", func(t *testing.T) {
+		sessiontest.Run(t, sessiontest.Config{
+			Advance: clock.Advance,
+			New: func(t *testing.T) wares.SessionManager {
+				return wares.NewCachedSessionManager(
+					plainManager{newMemory(t)},
+					&wares.CacheConfig{Clock: clock})
+			}})
+	})
+	t.Run("Sleeping", func(t *testing.T) {
+		sessiontest.Run(t, sessiontest.Config{
+			New: func(t *testing.T) wares.SessionManager {
+				manager := newMemoryManager()
+				t.Cleanup(func() { manager.Close() })
+				return manager
+			}})
+	})
+}
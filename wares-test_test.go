@@ -21,19 +21,21 @@ import (
 )
 
 const (
-	arbitraryJSON             = "{\"foo\": \"bar\"}"
-	customSafeErrorMessage    = "custom safe error message"
-	customUnsafeErrorMessage  = "custom unsafe error message"
-	root                      = "/test"
-	sessionIDExistent         = "SOME-EXISTENT-SESSION-ID"
-	sessionIDNonExistent      = "SOME-NONEXISTENT-SESSION-ID"
-	sessionIDWithDeleteError  = "SOME-EXISTENT-SESSION-ID-THAT-FAILS-TO-DELETE"
-	sessionIDWithMarshalError = "SOME-EXISTENT-SESSION-ID-THAT-FAILS-TO-MARSHAL"
-	sessionIDWithUserDestruct = "SOME-EXISTENT-SESSION-ID-THAT-USER-DESTRUCTS"
-	sessionIDWithSelfDestruct = "SOME-EXISTENT-SESSION-ID-THAT-SELF-DESTRUCTS"
-	sessionIDWithUpdateError  = "SOME-EXISTENT-SESSION-ID-THAT-FAILS-TO-UPDATE"
-	sessionUserID             = "SOME-USER-ID"
-	sessionUserJSON           = "{\"id\": \"" + sessionUserID + "\"}"
+	arbitraryJSON                = "{\"foo\": \"bar\"}"
+	customSafeErrorMessage       = "custom safe error message"
+	customUnsafeErrorMessage     = "custom unsafe error message"
+	root                         = "/test"
+	sessionIDExistent            = "SOME-EXISTENT-SESSION-ID"
+	sessionIDNonExistent         = "SOME-NONEXISTENT-SESSION-ID"
+	sessionIDWithDeleteError     = "SOME-EXISTENT-SESSION-ID-THAT-FAILS-TO-DELETE"
+	sessionIDWithMarshalError    = "SOME-EXISTENT-SESSION-ID-THAT-FAILS-TO-MARSHAL"
+	sessionIDWithUserDestruct    = "SOME-EXISTENT-SESSION-ID-THAT-USER-DESTRUCTS"
+	sessionIDWithSelfDestruct    = "SOME-EXISTENT-SESSION-ID-THAT-SELF-DESTRUCTS"
+	sessionIDWithRevokeError     = "SOME-EXISTENT-SESSION-ID-THAT-FAILS-TO-REVOKE"
+	sessionIDWithUpdateError     = "SOME-EXISTENT-SESSION-ID-THAT-FAILS-TO-UPDATE"
+	sessionUserID                = "SOME-USER-ID"
+	sessionUserIDWithRevokeError = "SOME-USER-ID-THAT-FAILS-TO-REVOKE"
+	sessionUserJSON              = "{\"id\": \"" + sessionUserID + "\"}"
 )
 
 type requested struct {
@@ -407,6 +409,145 @@ func TestSessionGetSuccessNonexistent(t *testing.T) {
 	makeRequest(t, app, params, want)
 }
 
+func TestSessionRegenerateBadSessionIDError(t *testing.T) {
+	method := "GET"
+	path := root + "/session-regenerate"
+	auth := sessionIDWithSelfDestruct
+	app := forest.New("")
+	app.RegisterRoute(root, newRouter(app))
+	params := &requested{auth: auth, method: method, path: path}
+	want := &wanted{code: http.StatusInternalServerError, success: false}
+	makeRequest(t, app, params, want)
+}
+
+func TestSessionRegenerateBadUserIDError(t *testing.T) {
+	method := "GET"
+	path := root + "/session-regenerate"
+	auth := sessionIDWithUserDestruct
+	app := forest.New("")
+	app.RegisterRoute(root, newRouter(app))
+	params := &requested{auth: auth, method: method, path: path}
+	want := &wanted{code: http.StatusInternalServerError, success: false}
+	makeRequest(t, app, params, want)
+}
+
+func TestSessionRegenerateDeleteError(t *testing.T) {
+	method := "GET"
+	path := root + "/session-regenerate"
+	auth := sessionIDWithDeleteError
+	app := forest.New("")
+	app.RegisterRoute(root, newRouter(app))
+	params := &requested{auth: auth, method: method, path: path}
+	want := &wanted{code: http.StatusInternalServerError, success: false}
+	makeRequest(t, app, params, want)
+}
+
+func TestSessionRegenerateMarshalError(t *testing.T) {
+	method := "GET"
+	path := root + "/session-regenerate"
+	auth := sessionIDWithMarshalError
+	app := forest.New("")
+	app.RegisterRoute(root, newRouter(app))
+	params := &requested{auth: auth, method: method, path: path}
+	want := &wanted{code: http.StatusInternalServerError, success: false}
+	makeRequest(t, app, params, want)
+}
+
+func TestSessionRegenerateSuccess(t *testing.T) {
+	method := "GET"
+	path := root + "/session-regenerate"
+	auth := sessionIDExistent
+	app := forest.New("")
+	app.RegisterRoute(root, newRouter(app))
+	params := &requested{auth: auth, method: method, path: path}
+	want := &wanted{code: http.StatusOK, success: true}
+	response, _ := makeRequest(t, app, params, want)
+	if response == nil {
+		return
+	}
+	cookies := response.Cookies()
+	cookie := cookies[len(cookies)-1]
+	if cookie.Name != forest.SessionID || cookie.Value == auth {
+		t.Errorf("%s %s should reset %s", method, path, forest.SessionID)
+	}
+}
+
+func TestSessionRevokeAnonymous(t *testing.T) {
+	method := "GET"
+	path := root + "/session-revoke"
+	app := forest.New("")
+	app.RegisterRoute(root, newRouter(app))
+	params := &requested{method: method, path: path}
+	want := &wanted{code: http.StatusUnauthorized, success: false}
+	makeRequest(t, app, params, want)
+}
+
+func TestSessionRevokeFailure(t *testing.T) {
+	method := "GET"
+	path := root + "/session-revoke"
+	auth := sessionIDWithRevokeError
+	app := forest.New("")
+	app.RegisterRoute(root, newRouter(app))
+	params := &requested{auth: auth, method: method, path: path}
+	want := &wanted{code: http.StatusInternalServerError, success: false}
+	makeRequest(t, app, params, want)
+}
+
+func TestSessionRevokeOthersBadSessionIDError(t *testing.T) {
+	method := "GET"
+	path := root + "/session-revoke/others"
+	auth := sessionIDWithSelfDestruct
+	app := forest.New("")
+	app.RegisterRoute(root, newRouter(app))
+	params := &requested{auth: auth, method: method, path: path}
+	want := &wanted{code: http.StatusInternalServerError, success: false}
+	makeRequest(t, app, params, want)
+}
+
+func TestSessionRevokeOthersMarshalError(t *testing.T) {
+	method := "GET"
+	path := root + "/session-revoke/others"
+	auth := sessionIDWithMarshalError
+	app := forest.New("")
+	app.RegisterRoute(root, newRouter(app))
+	params := &requested{auth: auth, method: method, path: path}
+	want := &wanted{code: http.StatusInternalServerError, success: false}
+	makeRequest(t, app, params, want)
+}
+
+func TestSessionRevokeOthersSuccess(t *testing.T) {
+	method := "GET"
+	path := root + "/session-revoke/others"
+	auth := sessionIDExistent
+	app := forest.New("")
+	app.RegisterRoute(root, newRouter(app))
+	params := &requested{auth: auth, method: method, path: path}
+	want := &wanted{code: http.StatusOK, success: true}
+	makeRequest(t, app, params, want)
+}
+
+func TestSessionRevokeOthersUpdateError(t *testing.T) {
+	method := "GET"
+	path := root + "/session-revoke/others"
+	auth := sessionIDWithUpdateError
+	app := forest.New("")
+	app.RegisterRoute(root, newRouter(app))
+	params := &requested{auth: auth, method: method, path: path}
+	want := &wanted{code: http.StatusInternalServerError, success: false}
+	makeRequest(t, app, params, want)
+}
+
+func TestSessionRevokeSuccess(t *testing.T) {
+	method := "GET"
+	path := root + "/session-revoke"
+	auth := sessionIDExistent
+	app := forest.New("")
+	app.RegisterRoute(root, newRouter(app))
+	params := &requested{auth: auth, method: method, path: path}
+	want := &wanted{code: http.StatusOK, success: true}
+	makeRequest(t, app, params, want)
+}
+
 func TestSessionSetBadSessionIDError(t *testing.T) {
 	method := "GET"
 	path := root + "/session-set"
@@ -17,39 +17,70 @@ import (
 
 type Ware func(ctx *bear.Context)
 
-func InstallBodyParser(app *forest.App) {
-	app.InstallWare("BodyParser", BodyParser(app), forest.WareInstalled)
+func InstallBodyParser(app *forest.App, opts ...Option) {
+	app.InstallWare("BodyParser", BodyParser(app, opts...), forest.WareInstalled)
 }
 
-func InstallErrorWares(app *forest.App) {
+func InstallCookieSessionWares(app *forest.App,
+	manager *CookieSessionManager, opts ...Option) {
+	app.InstallWare("SessionDel",
+		CookieSessionDel(app, manager, opts...), forest.WareInstalled)
+	app.InstallWare("SessionGet",
+		CookieSessionGet(app, manager, opts...), forest.WareInstalled)
+	app.InstallWare("SessionRevoke",
+		CookieSessionRevoke(app, manager, false, opts...),
+		forest.WareInstalled)
+	app.InstallWare("SessionRevokeOthers",
+		CookieSessionRevoke(app, manager, true, opts...),
+		forest.WareInstalled)
+	app.InstallWare("SessionSet",
+		CookieSessionSet(app, manager, opts...), forest.WareInstalled)
+}
+
+func InstallErrorWares(app *forest.App, opts ...Option) {
 	app.InstallWare("BadRequest",
-		ErrorsBadRequest(app), forest.WareInstalled)
+		ErrorsBadRequest(app, opts...), forest.WareInstalled)
 	app.InstallWare("Conflict",
-		ErrorsConflict(app), forest.WareInstalled)
+		ErrorsConflict(app, opts...), forest.WareInstalled)
 	app.InstallWare("MethodNotAllowed",
-		ErrorsMethodNotAllowed(app), forest.WareInstalled)
+		ErrorsMethodNotAllowed(app, opts...), forest.WareInstalled)
 	app.InstallWare("NotFound",
-		ErrorsNotFound(app), forest.WareInstalled)
+		ErrorsNotFound(app, opts...), forest.WareInstalled)
 	app.InstallWare("ServerError",
-		ErrorsServerError(app), forest.WareInstalled)
+		ErrorsServerError(app, opts...), forest.WareInstalled)
 	app.InstallWare("Unauthorized",
-		ErrorsUnauthorized(app), forest.WareInstalled)
+		ErrorsUnauthorized(app, opts...), forest.WareInstalled)
 }
 
-func InstallSecurityWares(app *forest.App) {
+func InstallSecurityWares(app *forest.App, opts ...Option) {
 	app.InstallWare("Authenticate",
-		Authenticate(app), forest.WareInstalled)
+		Authenticate(app, opts...), forest.WareInstalled)
 	app.InstallWare("CSRF",
-		CSRF(app), forest.WareInstalled)
+		CSRF(app, opts...), forest.WareInstalled)
 }
 
-func InstallSessionWares(app *forest.App, manager SessionManager) {
+func InstallSessionWares(app *forest.App, manager SessionManager,
+	opts ...Option) {
+	app.InstallWare("FlashGet",
+		FlashGet(app, manager, opts...), forest.WareInstalled)
+	app.InstallWare("FlashSet",
+		FlashSet(app, manager, opts...), forest.WareInstalled)
 	app.InstallWare("SessionDel",
-		SessionDel(app, manager), forest.WareInstalled)
+		SessionDel(app, manager, opts...), forest.WareInstalled)
+	app.InstallWare("SessionDelByID",
+		SessionDelByID(app, manager, opts...), forest.WareInstalled)
 	app.InstallWare("SessionGet",
-		SessionGet(app, manager), forest.WareInstalled)
+		SessionGet(app, manager, opts...), forest.WareInstalled)
+	app.InstallWare("SessionList",
+		SessionList(app, manager, opts...), forest.WareInstalled)
+	app.InstallWare("SessionRegenerate",
+		SessionRegenerate(app, manager, opts...), forest.WareInstalled)
+	app.InstallWare("SessionRevoke",
+		SessionRevoke(app, manager, false, opts...), forest.WareInstalled)
+	app.InstallWare("SessionRevokeOthers",
+		SessionRevoke(app, manager, true, opts...), forest.WareInstalled)
 	app.InstallWare("SessionSet",
-		SessionSet(app, manager), forest.WareInstalled)
+		SessionSet(app, manager, opts...), forest.WareInstalled)
 }
 
 func safeErrorMessage(app *forest.App, ctx *bear.Context,